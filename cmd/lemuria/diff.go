@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mishkaexe/lemuria/pkg/diff"
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+)
+
+// diffFlags are the flags of the diff command
+type diffFlags struct {
+	values, oldValues, newValues valueFlags
+	caps, oldCaps, newCaps       capabilityFlags
+	release                      releaseFlags
+
+	output       string
+	context      int
+	semantic     bool
+	normalize    bool
+	kubeDefaults bool
+	showSecrets  bool
+	ignoreRules  []string
+	policy       string
+}
+
+func runDiff(args []string, stdout, stderr io.Writer) (int, error) {
+	var f diffFlags
+	fs := newFlagSet("diff")
+	f.values.register(fs, "", " for both sides")
+	f.oldValues.register(fs, "old-", " for the old side")
+	f.newValues.register(fs, "new-", " for the new side")
+	f.caps.register(fs, "", " for both sides")
+	f.oldCaps.register(fs, "old-", " for the old side")
+	f.newCaps.register(fs, "new-", " for the new side")
+	f.release.register(fs)
+	fs.StringVarP(&f.output, "output", "o", "unified", "output format: "+strings.Join(diff.FormatterNames(), ", "))
+	fs.IntVarP(&f.context, "context", "U", diff.DefaultContextLines, "number of context lines")
+	fs.BoolVar(&f.semantic, "semantic", false, "only report differences in the parsed YAML structure")
+	fs.BoolVar(&f.normalize, "normalize", false, "ignore key order, quoting and empty fields")
+	fs.BoolVar(&f.kubeDefaults, "kubernetes-defaults", false, "fill in well-known Kubernetes defaults before comparing")
+	fs.BoolVar(&f.showSecrets, "show-secrets", false, "do not redact the values of Secrets")
+	fs.StringArrayVar(&f.ignoreRules, "ignore-rules", nil, "file of fields to ignore (can be repeated)")
+	fs.StringVar(&f.policy, "policy", "", "severity policy file; the exit code is the policy's code for the highest severity found, by default 1 for error and 0 otherwise, instead of 1 for any difference; 2 still means the diff failed and cannot be a policy code")
+	if err := parseFlags(fs, "diff OLD [NEW] [flags]", args, stdout); err != nil {
+		return exitError, err
+	}
+
+	// OLD and NEW are charts or manifest files; a single chart is rendered
+	// with the old and the new values
+	var oldArg, newArg string
+	switch fs.NArg() {
+	case 1:
+		oldArg, newArg = fs.Arg(0), fs.Arg(0)
+	case 2:
+		oldArg, newArg = fs.Arg(0), fs.Arg(1)
+	default:
+		return exitError, fmt.Errorf("expected one chart or two charts or manifest files, got %d arguments", fs.NArg())
+	}
+
+	opts, err := f.diffOptions()
+	if err != nil {
+		return exitError, err
+	}
+	var policy *diff.Policy
+	if f.policy != "" {
+		if policy, err = diff.LoadPolicy(f.policy); err != nil {
+			return exitError, err
+		}
+		if err := checkPolicyExitCodes(policy); err != nil {
+			return exitError, fmt.Errorf("invalid policy %s: %w", f.policy, err)
+		}
+	}
+	formatter, err := diff.NewFormatter(f.output)
+	if err != nil {
+		return exitError, err
+	}
+
+	renderer := helmrender.NewRenderer()
+	oldManifests, err := f.load(renderer, oldArg, &f.oldValues, &f.oldCaps)
+	if err != nil {
+		return exitError, err
+	}
+	newManifests, err := f.load(renderer, newArg, &f.newValues, &f.newCaps)
+	if err != nil {
+		return exitError, err
+	}
+
+	result, err := diff.New(opts...).CompareMultipleManifests(oldManifests, newManifests)
+	if err != nil {
+		return exitError, err
+	}
+	if err := formatter.Format(stdout, result); err != nil {
+		return exitError, err
+	}
+
+	if policy != nil {
+		classified, err := policy.Classify(result)
+		if err != nil {
+			return exitError, err
+		}
+		if len(classified.Violations) > 0 {
+			fmt.Fprintln(stderr, classified)
+		}
+		return classified.ExitCode(), nil
+	}
+	if result.HasDifferences() {
+		return exitDifferences, nil
+	}
+	return exitOK, nil
+}
+
+// checkPolicyExitCodes rejects policy exit codes that could not be told
+// apart from a failed diff
+func checkPolicyExitCodes(policy *diff.Policy) error {
+	for _, severity := range []diff.Severity{diff.SeverityNone, diff.SeverityInfo, diff.SeverityWarning, diff.SeverityError} {
+		if code, ok := policy.ExitCodes[severity]; ok && code == exitError {
+			return fmt.Errorf("exit code %d of severity %s is reserved for errors", code, severity)
+		}
+	}
+	return nil
+}
+
+// diffOptions builds the comparison options from the flags
+func (f *diffFlags) diffOptions() ([]diff.Option, error) {
+	opts := []diff.Option{diff.WithContextLines(f.context), diff.WithLabels("old", "new")}
+	if f.semantic {
+		opts = append(opts, diff.WithSemanticComparison())
+	}
+	if f.kubeDefaults {
+		opts = append(opts, diff.WithNormalizers(diff.KubernetesDefaults))
+	}
+	if f.normalize {
+		opts = append(opts, diff.WithNormalizers(diff.DefaultNormalizers...))
+	}
+	if f.showSecrets {
+		opts = append(opts, diff.WithoutSecretMasking())
+	}
+	for _, file := range f.ignoreRules {
+		rules, err := diff.LoadIgnoreRules(file)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, diff.WithIgnoreRules(rules...))
+	}
+	return opts, nil
+}
+
+// load returns the manifests of one side: the render of a chart directory
+// or packaged chart, or the content of a manifest file, "-" being stdin
+func (f *diffFlags) load(renderer *helmrender.ChartRenderer, arg string, side *valueFlags, sideCaps *capabilityFlags) (string, error) {
+	if !isChart(arg) {
+		if f.values.isSet() || side.isSet() {
+			return "", fmt.Errorf("%s is a manifest file and cannot take values", arg)
+		}
+		if f.caps.isSet() || sideCaps.isSet() {
+			return "", fmt.Errorf("%s is a manifest file and cannot take capabilities", arg)
+		}
+		var data []byte
+		var err error
+		if arg == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(arg)
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	opts := f.release.options(arg)
+	applyValues(&opts, &f.values, side)
+	applyCapabilities(&opts, &f.caps, sideCaps)
+	result, err := renderer.Render(opts)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(result.Manifests, "\n---\n"), nil
+}
+
+// isChart reports whether path is a chart directory or a packaged chart
+func isChart(path string) bool {
+	if strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".tar.gz") {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,91 @@
+// Command lemuria renders Helm charts and compares rendered manifests.
+//
+// Usage:
+//
+//	lemuria render CHART [flags]
+//	lemuria diff OLD [NEW] [flags]
+//
+// Manifests and diffs are written to stdout and errors to stderr. render
+// exits with 0 on success, diff with 0 when there are no differences and 1
+// when there are, and both exit with 2 on errors.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	exitOK          = 0
+	exitDifferences = 1
+	exitError       = 2
+)
+
+const usage = `Usage:
+  lemuria render CHART [flags]     render a chart to stdout or a directory
+  lemuria diff OLD [NEW] [flags]   compare two charts or manifest files
+
+Run "lemuria COMMAND --help" for the flags of a command.
+`
+
+// command is a subcommand, returning the process exit code
+type command func(args []string, stdout, stderr io.Writer) (int, error)
+
+var commands = map[string]command{
+	"render": runRender,
+	"diff":   runDiff,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+	switch args[0] {
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "lemuria: unknown command %q\n\n%s", args[0], usage)
+		return exitError
+	}
+	code, err := cmd(args[1:], stdout, stderr)
+	switch {
+	case errors.Is(err, pflag.ErrHelp):
+		return exitOK
+	case err != nil:
+		fmt.Fprintf(stderr, "lemuria %s: %v\n", args[0], err)
+		return exitError
+	}
+	return code
+}
+
+// newFlagSet creates the flag set of a subcommand. Parse errors are
+// reported by run, and -h or --help print the usage to stdout.
+func newFlagSet(name string) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.SortFlags = false
+	return fs
+}
+
+// parseFlags parses the arguments of a subcommand. Flags may follow the
+// positional arguments.
+func parseFlags(fs *pflag.FlagSet, synopsis string, args []string, stdout io.Writer) error {
+	err := fs.Parse(args)
+	if errors.Is(err, pflag.ErrHelp) {
+		fmt.Fprintf(stdout, "Usage:\n  lemuria %s\n\nFlags:\n%s", synopsis, fs.FlagUsages())
+	}
+	return err
+}
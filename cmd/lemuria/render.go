@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+)
+
+const sourcePrefix = "# Source: "
+
+func runRender(args []string, stdout, stderr io.Writer) (int, error) {
+	var (
+		values    valueFlags
+		caps      capabilityFlags
+		release   releaseFlags
+		outputDir string
+	)
+	fs := newFlagSet("render")
+	values.register(fs, "", "")
+	caps.register(fs, "", "")
+	release.register(fs)
+	fs.StringVarP(&outputDir, "output-dir", "o", "", "write manifests to files below this directory instead of stdout")
+	if err := parseFlags(fs, "render CHART [flags]", args, stdout); err != nil {
+		return exitError, err
+	}
+	if fs.NArg() != 1 {
+		return exitError, fmt.Errorf("expected a chart path, got %d arguments", fs.NArg())
+	}
+
+	opts := release.options(fs.Arg(0))
+	applyValues(&opts, &values)
+	applyCapabilities(&opts, &caps)
+	result, err := helmrender.NewRenderer().Render(opts)
+	if err != nil {
+		return exitError, err
+	}
+
+	if outputDir != "" {
+		if err := writeManifests(outputDir, result); err != nil {
+			return exitError, err
+		}
+		return exitOK, nil
+	}
+	for _, manifest := range result.Manifests {
+		fmt.Fprintf(stdout, "---\n%s\n", manifest)
+	}
+	return exitOK, nil
+}
+
+// writeManifests writes the manifests to the files named by their source
+// template below dir, and the notes to NOTES.txt
+func writeManifests(dir string, result *helmrender.RenderResult) error {
+	files := make(map[string][]string)
+	var order []string
+	for _, manifest := range result.Manifests {
+		name := manifestSource(manifest)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid manifest source %q", name)
+		}
+		if _, ok := files[name]; !ok {
+			order = append(order, name)
+		}
+		files[name] = append(files[name], manifest)
+	}
+	if result.Notes != "" {
+		order = append(order, "NOTES.txt")
+		files["NOTES.txt"] = []string{result.Notes}
+	}
+
+	for _, name := range order {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		content := strings.Join(files[name], "\n---\n") + "\n"
+		if name != "NOTES.txt" {
+			content = "---\n" + content
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manifestSource returns the template a manifest was rendered from, as
+// recorded by Helm in a leading "# Source:" comment
+func manifestSource(manifest string) string {
+	first, _, _ := strings.Cut(manifest, "\n")
+	if source, ok := strings.CutPrefix(first, sourcePrefix); ok {
+		return filepath.FromSlash(strings.TrimSpace(source))
+	}
+	return "manifests.yaml"
+}
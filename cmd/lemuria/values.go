@@ -0,0 +1,99 @@
+package main
+
+import (
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+	"github.com/spf13/pflag"
+)
+
+// valueFlags are the values files and --set style overrides of a render
+type valueFlags struct {
+	files      []string
+	set        []string
+	setString  []string
+	setJSON    []string
+	setFile    []string
+	setLiteral []string
+}
+
+// register adds the flags to fs, prefixing their names with prefix
+func (v *valueFlags) register(fs *pflag.FlagSet, prefix, side string) {
+	if prefix == "" {
+		fs.StringArrayVarP(&v.files, "values", "f", nil, "values file"+side+" (can be repeated)")
+	} else {
+		fs.StringArrayVar(&v.files, prefix+"values", nil, "values file"+side+" (can be repeated)")
+	}
+	fs.StringArrayVar(&v.set, prefix+"set", nil, "set values"+side+", as key1=val1,key2=val2")
+	fs.StringArrayVar(&v.setString, prefix+"set-string", nil, "set string values"+side)
+	fs.StringArrayVar(&v.setJSON, prefix+"set-json", nil, "set JSON values"+side+", as key=json")
+	fs.StringArrayVar(&v.setFile, prefix+"set-file", nil, "set values"+side+" from files, as key=path")
+	fs.StringArrayVar(&v.setLiteral, prefix+"set-literal", nil, "set a literal string value"+side)
+}
+
+func (v *valueFlags) isSet() bool {
+	return len(v.files)+len(v.set)+len(v.setString)+len(v.setJSON)+len(v.setFile)+len(v.setLiteral) > 0
+}
+
+// applyValues adds the values of layers to opts. Later layers take
+// precedence over earlier ones of the same kind.
+func applyValues(opts *helmrender.RenderOptions, layers ...*valueFlags) {
+	for _, v := range layers {
+		opts.ValuesFiles = append(opts.ValuesFiles, v.files...)
+		opts.Set = append(opts.Set, v.set...)
+		opts.SetString = append(opts.SetString, v.setString...)
+		opts.SetJSON = append(opts.SetJSON, v.setJSON...)
+		opts.SetFile = append(opts.SetFile, v.setFile...)
+		opts.SetLiteral = append(opts.SetLiteral, v.setLiteral...)
+	}
+}
+
+// releaseFlags are the release settings of a render
+type releaseFlags struct {
+	name      string
+	namespace string
+}
+
+func (r *releaseFlags) register(fs *pflag.FlagSet) {
+	fs.StringVar(&r.name, "release-name", "release-name", "release name")
+	fs.StringVarP(&r.namespace, "namespace", "n", "default", "release namespace")
+}
+
+// options builds the render options of a chart
+func (r *releaseFlags) options(chartPath string) helmrender.RenderOptions {
+	return helmrender.RenderOptions{
+		ChartPath:   chartPath,
+		ReleaseName: r.name,
+		Namespace:   r.namespace,
+	}
+}
+
+// capabilityFlags are the cluster capabilities a chart is rendered for
+type capabilityFlags struct {
+	kubeVersion string
+	apiVersions []string
+	file        string
+}
+
+// register adds the flags to fs, prefixing their names with prefix
+func (c *capabilityFlags) register(fs *pflag.FlagSet, prefix, side string) {
+	fs.StringVar(&c.kubeVersion, prefix+"kube-version", "", "Kubernetes version"+side+", such as 1.30")
+	fs.StringSliceVar(&c.apiVersions, prefix+"api-versions", nil, "additional API versions"+side+", such as monitoring.coreos.com/v1 (can be repeated)")
+	fs.StringVar(&c.file, prefix+"capabilities-file", "", "file of the Kubernetes version and API versions of a cluster, replacing Helm's default API versions"+side)
+}
+
+func (c *capabilityFlags) isSet() bool {
+	return c.kubeVersion != "" || len(c.apiVersions) > 0 || c.file != ""
+}
+
+// applyCapabilities adds the capabilities of layers to opts. The version and
+// file of later layers replace those of earlier ones, API versions add up.
+func applyCapabilities(opts *helmrender.RenderOptions, layers ...*capabilityFlags) {
+	for _, c := range layers {
+		if c.kubeVersion != "" {
+			opts.KubeVersion = c.kubeVersion
+		}
+		if c.file != "" {
+			opts.CapabilitiesFile = c.file
+		}
+		opts.APIVersions = append(opts.APIVersions, c.apiVersions...)
+	}
+}
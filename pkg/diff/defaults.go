@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// podSpecPaths locates the pod spec of the workload kinds
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// defaultValue is a field filled in when it is missing
+type defaultValue struct {
+	key, tag, value string
+}
+
+// workloadDefaults are the defaults of the spec of workload kinds
+var workloadDefaults = map[string][]defaultValue{
+	"Deployment": {
+		{"replicas", "!!int", "1"},
+		{"revisionHistoryLimit", "!!int", "10"},
+		{"progressDeadlineSeconds", "!!int", "600"},
+	},
+	"StatefulSet": {
+		{"replicas", "!!int", "1"},
+		{"podManagementPolicy", "!!str", "OrderedReady"},
+		{"revisionHistoryLimit", "!!int", "10"},
+	},
+}
+
+var podSpecDefaults = []defaultValue{
+	{"dnsPolicy", "!!str", "ClusterFirst"},
+	{"schedulerName", "!!str", "default-scheduler"},
+	{"terminationGracePeriodSeconds", "!!int", "30"},
+}
+
+var containerDefaults = []defaultValue{
+	{"terminationMessagePath", "!!str", "/dev/termination-log"},
+	{"terminationMessagePolicy", "!!str", "File"},
+}
+
+func applyKubernetesDefaults(id ResourceID, node *yaml.Node) bool {
+	if id.Kind == "Service" {
+		return applyServiceDefaults(mappingPath(node, "spec"))
+	}
+
+	changed := setDefaults(mappingPath(node, "spec"), workloadDefaults[id.Kind])
+	path, ok := podSpecPaths[id.Kind]
+	if !ok {
+		return changed
+	}
+	spec := mappingPath(node, path...)
+	if spec == nil {
+		return changed
+	}
+
+	// Jobs must not restart their pods and have no default restart policy
+	if id.Kind != "Job" && id.Kind != "CronJob" {
+		if setDefault(spec, defaultValue{"restartPolicy", "!!str", "Always"}) {
+			changed = true
+		}
+	}
+	if setDefaults(spec, podSpecDefaults) {
+		changed = true
+	}
+	for _, key := range []string{"containers", "initContainers"} {
+		list := mappingValue(spec, key)
+		if list == nil || list.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, container := range list.Content {
+			if applyContainerDefaults(container) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func applyContainerDefaults(container *yaml.Node) bool {
+	if container.Kind != yaml.MappingNode {
+		return false
+	}
+	changed := setDefaults(container, containerDefaults)
+	if image := mappingValue(container, "image"); image != nil && image.Kind == yaml.ScalarNode {
+		policy := "IfNotPresent"
+		if imageTag(image.Value) == "latest" {
+			policy = "Always"
+		}
+		if setDefault(container, defaultValue{"imagePullPolicy", "!!str", policy}) {
+			changed = true
+		}
+	}
+	if applyPortDefaults(mappingValue(container, "ports"), false) {
+		changed = true
+	}
+	return changed
+}
+
+func applyServiceDefaults(spec *yaml.Node) bool {
+	if spec == nil {
+		return false
+	}
+	changed := setDefaults(spec, []defaultValue{
+		{"type", "!!str", "ClusterIP"},
+		{"sessionAffinity", "!!str", "None"},
+	})
+	if applyPortDefaults(mappingValue(spec, "ports"), true) {
+		changed = true
+	}
+	return changed
+}
+
+// applyPortDefaults sets the protocol of ports to TCP and, for service
+// ports, the target port to the port
+func applyPortDefaults(ports *yaml.Node, service bool) bool {
+	if ports == nil || ports.Kind != yaml.SequenceNode {
+		return false
+	}
+	changed := false
+	for _, port := range ports.Content {
+		if port.Kind != yaml.MappingNode {
+			continue
+		}
+		if setDefault(port, defaultValue{"protocol", "!!str", "TCP"}) {
+			changed = true
+		}
+		if !service || mappingValue(port, "targetPort") != nil {
+			continue
+		}
+		// The style is kept so that a quoted port still reads as a quoted
+		// target port to CanonicalizeScalars
+		if number := mappingValue(port, "port"); number != nil && number.Kind == yaml.ScalarNode {
+			port.Content = append(port.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "targetPort"},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: number.ShortTag(), Style: number.Style, Value: number.Value})
+			changed = true
+		}
+	}
+	return changed
+}
+
+// imageTag returns the tag of an image reference: "latest" when it has
+// neither tag nor digest, and "" when it only has a digest
+func imageTag(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+		if !strings.Contains(image[strings.LastIndex(image, "/")+1:], ":") {
+			return ""
+		}
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return "latest"
+}
+
+// setDefaults fills in the missing fields of a mapping
+func setDefaults(node *yaml.Node, defaults []defaultValue) bool {
+	changed := false
+	for _, def := range defaults {
+		if setDefault(node, def) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// setDefault adds a field to a mapping unless it is already set
+func setDefault(node *yaml.Node, def defaultValue) bool {
+	if node == nil || node.Kind != yaml.MappingNode || mappingValue(node, def.key) != nil {
+		return false
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: def.key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: def.tag, Value: def.value})
+	return true
+}
+
+// mappingValue returns the value of key in a mapping, or nil when node is
+// not a mapping or has no such key
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingPath returns the mapping reached by following keys from node, or
+// nil when any of them is missing or not a mapping
+func mappingPath(node *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		node = mappingValue(node, key)
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	return node
+}
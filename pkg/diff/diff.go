@@ -1,144 +1,333 @@
 package diff
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
-type Diff struct{}
+type Diff struct {
+	contextLines    int
+	oldLabel        string
+	newLabel        string
+	semantic        bool
+	intraLine       Granularity
+	mergeKeys       MergeKeys
+	renameThreshold float64
+	ignore          []fieldSelector
+	mask            []fieldSelector
+	secretMask      []fieldSelector
+	maskSecrets     bool
+	maskKey         []byte
+	embedded        []fieldSelector
+	embedDocuments  bool
+	normalizers     []Normalizer
+
+	// err records an invalid option and is returned by every comparison
+	err error
+}
 
 type DiffResult struct {
 	differences bool
 	output      string
+	oldLabel    string
+	newLabel    string
+	hunks       []Hunk
+	changes     []FieldChange
+	resources   []ResourceDiff
+
+	// oldValue and newValue hold the decoded documents of a manifest
+	// comparison, after ignore and mask rules were applied
+	oldValue interface{}
+	newValue interface{}
+}
+
+// Stats summarises a comparison. Resource counts are only set for
+// multi-manifest comparisons.
+type Stats struct {
+	LinesAdded         int
+	LinesRemoved       int
+	FieldsChanged      int
+	ResourcesAdded     int
+	ResourcesRemoved   int
+	ResourcesModified  int
+	ResourcesRenamed   int
+	ResourcesUnchanged int
 }
 
 type diffLine struct {
 	text string
 	op   rune // ' ' for context, '-' for deletion, '+' for addition
+	// noNewline marks the last line of an input without a trailing newline
+	noNewline bool
 }
 
-func New() *Diff {
-	return &Diff{}
+func New(opts ...Option) *Diff {
+	d := &Diff{
+		contextLines:    DefaultContextLines,
+		mergeKeys:       DefaultMergeKeys,
+		renameThreshold: DefaultRenameThreshold,
+	}
+	d.secretMask, d.err = compileRules(DefaultMaskRules)
+	d.maskSecrets = true
+	d.maskKey = newMaskKey()
+	if d.err == nil {
+		d.embedded, d.err = compileRules(DefaultEmbeddedRules)
+	}
+	d.embedDocuments = true
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
 }
 
 func (d *Diff) CompareStrings(old, new string) (*DiffResult, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	return d.compareText(old, new, d.oldLabel, d.newLabel), nil
+}
+
+// compareText produces a line diff of old and new, using the given labels
+// for the unified diff file headers
+func (d *Diff) compareText(old, new, oldLabel, newLabel string) *DiffResult {
 	if old == new {
 		return &DiffResult{
 			differences: false,
 			output:      "",
-		}, nil
+		}
 	}
 
-	oldLines := strings.Split(old, "\n")
-	newLines := strings.Split(new, "\n")
+	oldLines, oldNoNewline := splitLines(old)
+	newLines, newNoNewline := splitLines(new)
+
+	diffs := d.computeDiff(oldLines, newLines, oldNoNewline, newNoNewline)
 
-	// Simple line-by-line diff algorithm
-	diffs := d.computeDiff(oldLines, newLines)
-	
-	if len(diffs) == 0 {
+	if !hasEdits(diffs) {
 		return &DiffResult{
 			differences: false,
 			output:      "",
-		}, nil
+		}
 	}
 
-	output := d.formatUnifiedDiff(diffs, oldLines, newLines)
+	hunks := d.buildHunks(diffs)
+	d.refineHunks(hunks)
 	return &DiffResult{
 		differences: true,
-		output:      output,
-	}, nil
-}
-
-func (d *Diff) computeDiff(oldLines, newLines []string) []diffLine {
-	var diffs []diffLine
-	
-	// Simple diff algorithm: compare line by line with context
-	maxLen := len(oldLines)
-	if len(newLines) > maxLen {
-		maxLen = len(newLines)
-	}
-	
-	oldIndex := 0
-	newIndex := 0
-	
+		output:      formatUnifiedDiff(hunks, oldLabel, newLabel),
+		oldLabel:    oldLabel,
+		newLabel:    newLabel,
+		hunks:       hunks,
+	}
+}
+
+// splitLines splits text into lines, treating an empty string as no lines.
+// The trailing newline ends the last line; noNewline reports whether the
+// text lacks it.
+func splitLines(s string) (lines []string, noNewline bool) {
+	if s == "" {
+		return nil, false
+	}
+	noNewline = !strings.HasSuffix(s, "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n"), noNewline
+}
+
+// computeDiff returns a minimal line-level edit script turning oldLines
+// into newLines, with deletions preceding additions within each change.
+// A last line without a trailing newline never matches a line with one.
+func (d *Diff) computeDiff(oldLines, newLines []string, oldNoNewline, newNoNewline bool) []diffLine {
+	table := make(symbolTable)
+	removed, inserted := editScript(
+		table.symbols(lineKeys(oldLines, oldNoNewline)),
+		table.symbols(lineKeys(newLines, newNoNewline)))
+
+	diffs := make([]diffLine, 0, len(oldLines)+len(newLines))
+	oldIndex, newIndex := 0, 0
 	for oldIndex < len(oldLines) || newIndex < len(newLines) {
-		if oldIndex < len(oldLines) && newIndex < len(newLines) {
-			if oldLines[oldIndex] == newLines[newIndex] {
-				// Lines match - add as context
-				diffs = append(diffs, diffLine{text: oldLines[oldIndex], op: ' '})
-				oldIndex++
-				newIndex++
-			} else {
-				// Lines differ - check if it's a substitution or separate add/delete
-				if d.findLineInSlice(oldLines[oldIndex], newLines[newIndex:]) != -1 {
-					// Old line exists later in new - this is an addition
-					diffs = append(diffs, diffLine{text: newLines[newIndex], op: '+'})
-					newIndex++
-				} else if d.findLineInSlice(newLines[newIndex], oldLines[oldIndex:]) != -1 {
-					// New line exists later in old - this is a deletion
-					diffs = append(diffs, diffLine{text: oldLines[oldIndex], op: '-'})
-					oldIndex++
-				} else {
-					// Simple substitution
-					diffs = append(diffs, diffLine{text: oldLines[oldIndex], op: '-'})
-					diffs = append(diffs, diffLine{text: newLines[newIndex], op: '+'})
-					oldIndex++
-					newIndex++
-				}
-			}
-		} else if oldIndex < len(oldLines) {
-			// Remaining old lines are deletions
-			diffs = append(diffs, diffLine{text: oldLines[oldIndex], op: '-'})
+		switch {
+		case oldIndex < len(oldLines) && removed[oldIndex]:
+			diffs = append(diffs, diffLine{text: oldLines[oldIndex], op: '-', noNewline: oldNoNewline && oldIndex == len(oldLines)-1})
+			oldIndex++
+		case newIndex < len(newLines) && inserted[newIndex]:
+			diffs = append(diffs, diffLine{text: newLines[newIndex], op: '+', noNewline: newNoNewline && newIndex == len(newLines)-1})
+			newIndex++
+		default:
+			diffs = append(diffs, diffLine{text: oldLines[oldIndex], op: ' ', noNewline: oldNoNewline && oldIndex == len(oldLines)-1})
 			oldIndex++
-		} else {
-			// Remaining new lines are additions
-			diffs = append(diffs, diffLine{text: newLines[newIndex], op: '+'})
 			newIndex++
 		}
 	}
-	
+
 	return diffs
 }
 
-func (d *Diff) findLineInSlice(line string, slice []string) int {
-	for i, l := range slice {
-		if l == line {
-			return i
-		}
+// lineKeys returns the lines to match, with a newline appended to a last
+// line that lacks one so that it differs from the same line ending in one
+func lineKeys(lines []string, noNewline bool) []string {
+	if !noNewline {
+		return lines
 	}
-	return -1
+	keys := append([]string(nil), lines...)
+	keys[len(keys)-1] += "\n"
+	return keys
 }
 
-func (d *Diff) formatUnifiedDiff(diffs []diffLine, oldLines, newLines []string) string {
-	var result strings.Builder
-	
-	// Add unified diff header
-	result.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", 1, len(oldLines), 1, len(newLines)))
-	
-	// Add diff lines
+// hasEdits reports whether diffs contains any addition or deletion
+func hasEdits(diffs []diffLine) bool {
 	for _, diff := range diffs {
-		result.WriteString(fmt.Sprintf("%c%s\n", diff.op, diff.text))
+		if diff.op != ' ' {
+			return true
+		}
 	}
-	
-	return strings.TrimSuffix(result.String(), "\n")
+	return false
 }
 
 func (d *Diff) CompareManifests(oldManifest, newManifest string) (*DiffResult, error) {
-	// For now, treat manifests as regular strings
-	// In the future, we could add YAML-aware comparison here
-	return d.CompareStrings(oldManifest, newManifest)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return d.compareManifest(oldManifest, newManifest, d.oldLabel, d.newLabel)
+}
+
+// compareManifest compares two single-document manifests. Manifests that
+// are not valid YAML are compared as text, unless semantic comparison is
+// enabled or the text could hold masked values, in which case the parse
+// error is returned: masking cannot be applied to text.
+func (d *Diff) compareManifest(oldManifest, newManifest, oldLabel, newLabel string) (*DiffResult, error) {
+	oldDoc, oldErr := d.parseManifest(oldManifest)
+	newDoc, newErr := d.parseManifest(newManifest)
+	if oldErr != nil || newErr != nil {
+		if d.semantic || d.mayHoldMasked(oldManifest) || d.mayHoldMasked(newManifest) {
+			return nil, fmt.Errorf("failed to parse manifest: %w", errors.Join(oldErr, newErr))
+		}
+		return d.compareText(oldManifest, newManifest, oldLabel, newLabel), nil
+	}
+
+	return d.compareDocuments(oldDoc, newDoc, oldLabel, newLabel)
 }
 
-func (d *Diff) CompareMultipleManifests(oldManifests, newManifests string) (*DiffResult, error) {
-	// For now, treat multiple manifests as regular strings
-	// In the future, we could parse and compare individual manifests
-	return d.CompareStrings(oldManifests, newManifests)
+// compareDocuments produces both the line diff and the structural changes
+// of two parsed manifests
+func (d *Diff) compareDocuments(oldDoc, newDoc manifest, oldLabel, newLabel string) (*DiffResult, error) {
+	oldText, newText := oldDoc.text, newDoc.text
+	// Once either side has been rewritten, both are re-encoded so that
+	// the text diff does not pick up formatting differences
+	if oldDoc.rewritten || newDoc.rewritten {
+		var err error
+		if oldText, err = oldDoc.encode(); err != nil {
+			return nil, err
+		}
+		if newText, err = newDoc.encode(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := d.compareText(oldText, newText, oldLabel, newLabel)
+
+	oldValue, err := oldDoc.value()
+	if err != nil {
+		return nil, err
+	}
+	newValue, err := newDoc.value()
+	if err != nil {
+		return nil, err
+	}
+	result.oldValue = normalizeValue(oldValue)
+	result.newValue = normalizeValue(newValue)
+	id := newDoc.id
+	if newDoc.node == nil {
+		id = oldDoc.id
+	}
+	result.changes = d.compareValues(id, result.oldValue, result.newValue)
+
+	// Formatting-only differences are not differences in semantic mode
+	if d.semantic && len(result.changes) == 0 {
+		result.differences = false
+		result.output = ""
+		result.hunks = nil
+	}
+
+	return result, nil
 }
 
 func (r *DiffResult) HasDifferences() bool {
 	return r.differences
 }
 
+// Hunks returns the hunks of the line diff. For multi-manifest comparisons
+// the hunks are available on each entry of Resources.
+func (r *DiffResult) Hunks() []Hunk {
+	return r.hunks
+}
+
+// Changes returns the structural changes between two manifests, identified
+// by their path within the document. For multi-manifest comparisons the
+// changes are available on each entry of Resources.
+func (r *DiffResult) Changes() []FieldChange {
+	return r.changes
+}
+
+// Resources returns the per-resource results of a multi-manifest comparison
+func (r *DiffResult) Resources() []ResourceDiff {
+	return r.resources
+}
+
+// Stats counts the changed lines, fields and resources of the comparison
+func (r *DiffResult) Stats() Stats {
+	var stats Stats
+	for _, h := range r.hunks {
+		for _, line := range h.Lines {
+			switch line.Op {
+			case '+':
+				stats.LinesAdded++
+			case '-':
+				stats.LinesRemoved++
+			}
+		}
+	}
+	stats.FieldsChanged = len(r.changes)
+
+	for _, res := range r.resources {
+		switch res.Change {
+		case Added:
+			stats.ResourcesAdded++
+		case Removed:
+			stats.ResourcesRemoved++
+		case Modified:
+			stats.ResourcesModified++
+		case Renamed:
+			stats.ResourcesRenamed++
+		case Unchanged:
+			stats.ResourcesUnchanged++
+		}
+		resStats := res.Result.Stats()
+		stats.LinesAdded += resStats.LinesAdded
+		stats.LinesRemoved += resStats.LinesRemoved
+		stats.FieldsChanged += resStats.FieldsChanged
+	}
+
+	return stats
+}
+
 func (r *DiffResult) String() string {
 	return r.output
-}
\ No newline at end of file
+}
+
+// StructuralString returns the structural changes one per line. Changes of
+// a multi-manifest comparison are grouped under their resource.
+func (r *DiffResult) StructuralString() string {
+	var lines []string
+	for _, change := range r.changes {
+		lines = append(lines, change.String())
+	}
+	for _, res := range r.resources {
+		if res.Change == Unchanged {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s):", res.ID, changeDescription(res.Change, res.From)))
+		for _, change := range res.Result.Changes() {
+			lines = append(lines, "  "+change.String())
+		}
+	}
+	return strings.Join(lines, "\n")
+}
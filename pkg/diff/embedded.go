@@ -0,0 +1,280 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EmbeddedFormat is the format of a document embedded in a string value
+type EmbeddedFormat string
+
+const (
+	FormatJSON       EmbeddedFormat = "json"
+	FormatYAML       EmbeddedFormat = "yaml"
+	FormatTOML       EmbeddedFormat = "toml"
+	FormatProperties EmbeddedFormat = "properties"
+	// FormatText is multi-line text without a recognised structure, which
+	// is compared line by line
+	FormatText EmbeddedFormat = "text"
+)
+
+// DefaultEmbeddedRules select the values of ConfigMap data, which commonly
+// hold whole configuration files
+var DefaultEmbeddedRules = []FieldRule{
+	{Kind: "ConfigMap", Paths: []string{"data.*"}},
+}
+
+// formatExtensions maps file extensions of ConfigMap keys to formats
+var formatExtensions = map[string]EmbeddedFormat{
+	".json":       FormatJSON,
+	".yaml":       FormatYAML,
+	".yml":        FormatYAML,
+	".toml":       FormatTOML,
+	".properties": FormatProperties,
+}
+
+// sniffOrder is the order in which content is tested against the formats
+// when the key gives no hint. JSON is also valid YAML and is tried first.
+var sniffOrder = []EmbeddedFormat{FormatJSON, FormatYAML, FormatTOML, FormatProperties}
+
+// isEmbedded reports whether a pair of string values at path is compared
+// as an embedded document
+func (w *structuralWalker) isEmbedded(path []pathSegment, old, new string) bool {
+	if isRedacted(old) || isRedacted(new) {
+		return false
+	}
+	for _, sel := range w.embedded {
+		if sel.matches(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkEmbedded compares two versions of an embedded document. Documents
+// that parse in a common format are compared structurally below path, so
+// a change to a JSON file in a ConfigMap is reported as, for example,
+// data["config.json"].cache.ttl. Other multi-line text is reported as a
+// single change carrying a line diff.
+func (w *structuralWalker) walkEmbedded(path []pathSegment, old, new string) {
+	// A rule matching the document root has no key to take a hint from
+	key := ""
+	if len(path) > 0 {
+		key = path[len(path)-1].key
+	}
+	format := detectFormat(key, old, new)
+	if format != FormatText {
+		oldDoc, oldErr := parseEmbedded(format, old)
+		newDoc, newErr := parseEmbedded(format, new)
+		if oldErr == nil && newErr == nil {
+			inner := &structuralWalker{d: w.d}
+			inner.walk(path, oldDoc, newDoc)
+			for _, c := range inner.changes {
+				c.Embedded = format
+				w.changes = append(w.changes, c)
+			}
+			return
+		}
+	}
+
+	if !isMultiLine(old) && !isMultiLine(new) {
+		w.record(path, Modified, old, new)
+		return
+	}
+	c := newFieldChange(path, Modified, old, new)
+	c.Embedded = FormatText
+	c.Hunks = w.d.compareText(old, new, "", "").hunks
+	w.changes = append(w.changes, c)
+}
+
+// isMultiLine reports whether s has more than one line, not counting a
+// final line break as block scalars have
+func isMultiLine(s string) bool {
+	return strings.Contains(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// detectFormat determines the format of an embedded document from the
+// extension of its key, or else from the content of both versions
+func detectFormat(key, old, new string) EmbeddedFormat {
+	if format, ok := formatExtensions[strings.ToLower(path.Ext(key))]; ok {
+		return format
+	}
+	for _, format := range sniffOrder {
+		if sniffFormat(format, old) && sniffFormat(format, new) {
+			return format
+		}
+	}
+	return FormatText
+}
+
+// sniffFormat reports whether s looks like a document of the given format.
+// Apart from JSON, only multi-line values are considered documents, since
+// single-line values such as "key: value" are usually plain settings.
+func sniffFormat(format EmbeddedFormat, s string) bool {
+	if format == FormatJSON {
+		trimmed := strings.TrimSpace(s)
+		return (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed))
+	}
+	if !isMultiLine(strings.TrimSpace(s)) {
+		return false
+	}
+	if format == FormatProperties && !hasPropertyAssignments(s) {
+		return false
+	}
+
+	v, err := parseEmbedded(format, s)
+	if err != nil {
+		return false
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return len(t) > 0
+	case []interface{}:
+		return format == FormatYAML && len(t) > 0
+	default:
+		return false
+	}
+}
+
+// hasPropertyAssignments reports whether every entry of a properties file
+// uses '=' as separator. Whitespace separators are valid but would make
+// almost any text look like a properties file.
+func hasPropertyAssignments(s string) bool {
+	lines := strings.Split(s, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		if !strings.Contains(line, "=") {
+			return false
+		}
+		for continued(line) && i+1 < len(lines) {
+			i++
+			line = strings.TrimSpace(lines[i])
+		}
+	}
+	return true
+}
+
+// parseEmbedded decodes an embedded document into generic maps, slices and
+// scalars
+func parseEmbedded(format EmbeddedFormat, s string) (interface{}, error) {
+	var v interface{}
+	switch format {
+	case FormatJSON:
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, err
+		}
+	case FormatYAML:
+		if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		var m map[string]interface{}
+		if _, err := toml.Decode(s, &m); err != nil {
+			return nil, err
+		}
+		v = m
+	case FormatProperties:
+		m, err := parseProperties(s)
+		if err != nil {
+			return nil, err
+		}
+		v = m
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	return normalizeValue(v), nil
+}
+
+// parseProperties decodes a Java properties file. Keys and values are
+// separated by '=', ':' or whitespace, lines starting with '#' or '!' are
+// comments and a trailing backslash continues a line.
+func parseProperties(s string) (map[string]interface{}, error) {
+	props := make(map[string]interface{})
+
+	lines := strings.Split(s, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(strings.TrimRight(lines[i], "\r"), " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		for continued(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(strings.TrimRight(lines[i], "\r"), " \t\f")
+		}
+
+		key, value, ok := splitProperty(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing separator", i+1)
+		}
+		props[unescapeProperty(key)] = unescapeProperty(value)
+	}
+
+	return props, nil
+}
+
+// continued reports whether a properties line ends with an unescaped
+// backslash
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty splits a properties line at the first unescaped separator
+func splitProperty(line string) (string, string, bool) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return strings.TrimRight(line[:i], " \t\f"), strings.TrimLeft(line[i+1:], " \t\f"), true
+		case ' ', '\t', '\f':
+			key := line[:i]
+			rest := strings.TrimLeft(line[i:], " \t\f")
+			if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+				rest = strings.TrimLeft(rest[1:], " \t\f")
+			}
+			return key, rest, true
+		}
+	}
+	return "", "", false
+}
+
+// unescapeProperty resolves the backslash escapes of a properties key or
+// value
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
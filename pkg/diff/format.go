@@ -0,0 +1,117 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Formatter renders a DiffResult for a particular consumer
+type Formatter interface {
+	Format(w io.Writer, result *DiffResult) error
+}
+
+// FormatterFunc adapts a function to the Formatter interface
+type FormatterFunc func(w io.Writer, result *DiffResult) error
+
+func (f FormatterFunc) Format(w io.Writer, result *DiffResult) error {
+	return f(w, result)
+}
+
+// formatters holds the built-in formatters by name. The terminal
+// formatters detect colour support and width from the writer they are
+// given.
+var formatters = map[string]Formatter{
+	"unified":    UnifiedFormatter{},
+	"json":       JSONFormatter{Indent: true},
+	"json-patch": JSONPatchFormatter{Indent: true},
+	"markdown":   MarkdownFormatter{},
+	"html":       HTMLFormatter{},
+	"word-diff":  WordDiffFormatter{},
+	"terminal": FormatterFunc(func(w io.Writer, result *DiffResult) error {
+		return NewTerminalFormatter(w, false).Format(w, result)
+	}),
+	"side-by-side": FormatterFunc(func(w io.Writer, result *DiffResult) error {
+		return NewTerminalFormatter(w, true).Format(w, result)
+	}),
+}
+
+// NewFormatter returns the built-in formatter with the given name: one of
+// the names returned by FormatterNames
+func NewFormatter(name string) (Formatter, error) {
+	f, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q", name)
+	}
+	return f, nil
+}
+
+// FormatterNames returns the names of the built-in formatters
+func FormatterNames() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnifiedFormatter writes the unified diff text returned by String
+type UnifiedFormatter struct{}
+
+func (UnifiedFormatter) Format(w io.Writer, result *DiffResult) error {
+	if !result.HasDifferences() {
+		return nil
+	}
+	_, err := fmt.Fprintln(w, result.String())
+	return err
+}
+
+// section is a unit of formatted output: one resource of a multi-manifest
+// comparison, or the whole result of a single comparison
+type section struct {
+	id     *ResourceID
+	from   *ResourceID
+	change ChangeType
+	result *DiffResult
+}
+
+// title names the section in human-readable output
+func (s section) title() string {
+	if s.id == nil {
+		return "manifest"
+	}
+	return s.id.String()
+}
+
+// description describes the change of the section
+func (s section) description() string {
+	return changeDescription(s.change, s.from)
+}
+
+// sections splits a result into the parts formatters render separately
+func sections(result *DiffResult) []section {
+	if len(result.resources) == 0 {
+		change := Unchanged
+		if result.HasDifferences() {
+			change = Modified
+		}
+		return []section{{change: change, result: result}}
+	}
+
+	secs := make([]section, len(result.resources))
+	for i := range result.resources {
+		res := &result.resources[i]
+		secs[i] = section{id: &res.ID, from: res.From, change: res.Change, result: res.Result}
+	}
+	return secs
+}
+
+// summary counts the resources of a multi-manifest comparison by change
+func summary(stats Stats) string {
+	s := fmt.Sprintf("%d added, %d removed, %d modified", stats.ResourcesAdded, stats.ResourcesRemoved, stats.ResourcesModified)
+	if stats.ResourcesRenamed > 0 {
+		s += fmt.Sprintf(", %d renamed", stats.ResourcesRenamed)
+	}
+	return s + fmt.Sprintf(", %d unchanged", stats.ResourcesUnchanged)
+}
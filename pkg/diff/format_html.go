@@ -0,0 +1,136 @@
+package diff
+
+import (
+	"html/template"
+	"io"
+)
+
+// HTMLFormatter writes a self-contained HTML report with a side-by-side
+// view of every changed resource. The page has no external dependencies
+// so it can be stored as a CI artifact and opened directly.
+type HTMLFormatter struct {
+	// Title is used for the page title and heading; it defaults to
+	// "Manifest diff"
+	Title string
+}
+
+type htmlReport struct {
+	Title       string
+	Differences bool
+	Summary     string
+	Multi       bool
+	Sections    []htmlSection
+}
+
+type htmlSection struct {
+	Title  string
+	Change string
+	Counts string
+	Hunks  []htmlHunk
+}
+
+type htmlHunk struct {
+	Header string
+	Rows   []htmlRow
+}
+
+type htmlRow struct {
+	OldNumber int
+	OldText   string
+	OldClass  string
+	NewNumber int
+	NewText   string
+	NewClass  string
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1f2328; }
+h1 { font-size: 1.5em; }
+section { border: 1px solid #d0d7de; border-radius: 6px; margin-bottom: 1.5em; overflow: hidden; }
+section h2 { font-size: 1em; margin: 0; padding: 0.6em 1em; background: #f6f8fa; border-bottom: 1px solid #d0d7de; }
+.change { font-weight: normal; color: #59636e; margin-left: 0.5em; }
+table { border-collapse: collapse; width: 100%; table-layout: fixed; font-family: ui-monospace, SFMono-Regular, Menlo, monospace; font-size: 12px; }
+td { padding: 0 0.5em; vertical-align: top; white-space: pre-wrap; word-break: break-all; }
+td.num { width: 3.5em; text-align: right; color: #59636e; user-select: none; }
+tr.hunk td { background: #ddf4ff; color: #59636e; padding: 0.2em 0.5em; }
+td.del { background: #ffebe9; }
+td.ins { background: #e6ffec; }
+td.empty { background: #f6f8fa; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if not .Differences}}
+<p>No differences.</p>
+{{- else}}
+{{- if .Multi}}
+<p>{{.Summary}}</p>
+{{- end}}
+{{- range .Sections}}
+<section>
+<h2>{{.Title}}<span class="change">{{.Change}} ({{.Counts}})</span></h2>
+<table>
+{{- range .Hunks}}
+<tr class="hunk"><td colspan="4">{{.Header}}</td></tr>
+{{- range .Rows}}
+<tr><td class="num">{{if .OldNumber}}{{.OldNumber}}{{end}}</td><td class="{{.OldClass}}">{{.OldText}}</td><td class="num">{{if .NewNumber}}{{.NewNumber}}{{end}}</td><td class="{{.NewClass}}">{{.NewText}}</td></tr>
+{{- end}}
+{{- end}}
+</table>
+</section>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+func (f HTMLFormatter) Format(w io.Writer, result *DiffResult) error {
+	report := htmlReport{
+		Title:       f.Title,
+		Differences: result.HasDifferences(),
+		Summary:     summary(result.Stats()),
+		Multi:       len(result.Resources()) > 0,
+	}
+	if report.Title == "" {
+		report.Title = "Manifest diff"
+	}
+
+	for _, sec := range sections(result) {
+		if sec.change == Unchanged {
+			continue
+		}
+		hs := htmlSection{Title: sec.title(), Change: sec.description(), Counts: lineCounts(sec.result)}
+		for _, h := range sec.result.Hunks() {
+			hh := htmlHunk{Header: h.Header()}
+			for _, row := range sideBySideRows(h) {
+				hh.Rows = append(hh.Rows, newHTMLRow(row))
+			}
+			hs.Hunks = append(hs.Hunks, hh)
+		}
+		report.Sections = append(report.Sections, hs)
+	}
+
+	return htmlTemplate.Execute(w, report)
+}
+
+func newHTMLRow(row sideBySideRow) htmlRow {
+	r := htmlRow{OldClass: "empty", NewClass: "empty"}
+	if row.old != nil {
+		r.OldNumber, r.OldText, r.OldClass = row.old.OldNumber, row.old.Text, "ctx"
+		if row.old.Op == '-' {
+			r.OldClass = "del"
+		}
+	}
+	if row.new != nil {
+		r.NewNumber, r.NewText, r.NewClass = row.new.NewNumber, row.new.Text, "ctx"
+		if row.new.Op == '+' {
+			r.NewClass = "ins"
+		}
+	}
+	return r
+}
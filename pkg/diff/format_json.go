@@ -0,0 +1,343 @@
+package diff
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONFormatter writes the structured result as a JSON document with the
+// summary statistics, the hunks and field changes of every resource
+type JSONFormatter struct {
+	Indent bool
+}
+
+type jsonResult struct {
+	Differences bool           `json:"differences"`
+	Stats       jsonStats      `json:"stats"`
+	Hunks       []jsonHunk     `json:"hunks,omitempty"`
+	Changes     []jsonChange   `json:"changes,omitempty"`
+	Resources   []jsonResource `json:"resources,omitempty"`
+}
+
+type jsonStats struct {
+	LinesAdded         int `json:"linesAdded"`
+	LinesRemoved       int `json:"linesRemoved"`
+	FieldsChanged      int `json:"fieldsChanged"`
+	ResourcesAdded     int `json:"resourcesAdded"`
+	ResourcesRemoved   int `json:"resourcesRemoved"`
+	ResourcesModified  int `json:"resourcesModified"`
+	ResourcesRenamed   int `json:"resourcesRenamed"`
+	ResourcesUnchanged int `json:"resourcesUnchanged"`
+}
+
+type jsonResourceID struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+type jsonResource struct {
+	jsonResourceID
+	Change     ChangeType      `json:"change"`
+	From       *jsonResourceID `json:"from,omitempty"`
+	Similarity float64         `json:"similarity,omitempty"`
+	Hunks      []jsonHunk      `json:"hunks,omitempty"`
+	Changes    []jsonChange    `json:"changes,omitempty"`
+}
+
+type jsonHunk struct {
+	OldStart int        `json:"oldStart"`
+	OldLines int        `json:"oldLines"`
+	NewStart int        `json:"newStart"`
+	NewLines int        `json:"newLines"`
+	Lines    []jsonLine `json:"lines"`
+}
+
+type jsonLine struct {
+	Op        string        `json:"op"`
+	Text      string        `json:"text"`
+	OldNumber int           `json:"oldNumber,omitempty"`
+	NewNumber int           `json:"newNumber,omitempty"`
+	Segments  []jsonSegment `json:"segments,omitempty"`
+	NoNewline bool          `json:"noNewline,omitempty"`
+}
+
+type jsonSegment struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type jsonChange struct {
+	Path     string         `json:"path"`
+	Change   ChangeType     `json:"change"`
+	OldValue interface{}    `json:"oldValue,omitempty"`
+	NewValue interface{}    `json:"newValue,omitempty"`
+	Masked   bool           `json:"masked,omitempty"`
+	Segments []jsonSegment  `json:"segments,omitempty"`
+	Embedded EmbeddedFormat `json:"embedded,omitempty"`
+	Hunks    []jsonHunk     `json:"hunks,omitempty"`
+}
+
+func (f JSONFormatter) Format(w io.Writer, result *DiffResult) error {
+	stats := result.Stats()
+	doc := jsonResult{
+		Differences: result.HasDifferences(),
+		Stats:       jsonStats(stats),
+		Hunks:       toJSONHunks(result.Hunks()),
+		Changes:     toJSONChanges(result.Changes()),
+	}
+	for _, res := range result.Resources() {
+		doc.Resources = append(doc.Resources, jsonResource{
+			jsonResourceID: toJSONResourceID(res.ID),
+			Change:         res.Change,
+			From:           toJSONResourceIDPtr(res.From),
+			Similarity:     res.Similarity,
+			Hunks:          toJSONHunks(res.Result.Hunks()),
+			Changes:        toJSONChanges(res.Result.Changes()),
+		})
+	}
+	return writeJSON(w, doc, f.Indent)
+}
+
+func toJSONResourceID(id ResourceID) jsonResourceID {
+	return jsonResourceID{APIVersion: id.APIVersion, Kind: id.Kind, Namespace: id.Namespace, Name: id.Name}
+}
+
+func toJSONResourceIDPtr(id *ResourceID) *jsonResourceID {
+	if id == nil {
+		return nil
+	}
+	result := toJSONResourceID(*id)
+	return &result
+}
+
+func toJSONHunks(hunks []Hunk) []jsonHunk {
+	var result []jsonHunk
+	for _, h := range hunks {
+		jh := jsonHunk{OldStart: h.OldStart, OldLines: h.OldLines, NewStart: h.NewStart, NewLines: h.NewLines}
+		for _, line := range h.Lines {
+			jh.Lines = append(jh.Lines, jsonLine{
+				Op:        lineOpName(line.Op),
+				Text:      line.Text,
+				OldNumber: line.OldNumber,
+				NewNumber: line.NewNumber,
+				Segments:  toJSONSegments(line.Segments),
+				NoNewline: line.NoNewline,
+			})
+		}
+		result = append(result, jh)
+	}
+	return result
+}
+
+func lineOpName(op rune) string {
+	switch op {
+	case '+':
+		return "added"
+	case '-':
+		return "removed"
+	default:
+		return "context"
+	}
+}
+
+func toJSONChanges(changes []FieldChange) []jsonChange {
+	var result []jsonChange
+	for _, c := range changes {
+		result = append(result, jsonChange{
+			Path:     c.Path,
+			Change:   c.Change,
+			OldValue: c.OldValue,
+			NewValue: c.NewValue,
+			Masked:   c.Masked,
+			Segments: toJSONSegments(c.Segments),
+			Embedded: c.Embedded,
+			Hunks:    toJSONHunks(c.Hunks),
+		})
+	}
+	return result
+}
+
+func toJSONSegments(segments []Segment) []jsonSegment {
+	var result []jsonSegment
+	for _, seg := range segments {
+		op := lineOpName(seg.Op)
+		if seg.Op == ' ' {
+			op = "unchanged"
+		}
+		result = append(result, jsonSegment{Op: op, Text: seg.Text})
+	}
+	return result
+}
+
+func writeJSON(w io.Writer, v interface{}, indent bool) error {
+	enc := json.NewEncoder(w)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+// JSONPatchFormatter writes an RFC 6902 JSON Patch for every changed
+// resource that turns its old document into its new one. Added resources
+// are patched from an absent document with an add of the root, and removed
+// resources to an absent document with a remove of the root.
+type JSONPatchFormatter struct {
+	Indent bool
+}
+
+type jsonPatchEntry struct {
+	Resource *jsonResourceID `json:"resource,omitempty"`
+	Change   ChangeType      `json:"change"`
+	From     *jsonResourceID `json:"from,omitempty"`
+	Patch    []patchOp       `json:"patch,omitempty"`
+}
+
+func (f JSONPatchFormatter) Format(w io.Writer, result *DiffResult) error {
+	entries := []jsonPatchEntry{}
+	for _, sec := range sections(result) {
+		if sec.change == Unchanged {
+			continue
+		}
+		entries = append(entries, jsonPatchEntry{
+			Resource: toJSONResourceIDPtr(sec.id),
+			Change:   sec.change,
+			From:     toJSONResourceIDPtr(sec.from),
+			Patch:    jsonPatch(sec.result.oldValue, sec.result.newValue),
+		})
+	}
+	return writeJSON(w, entries, f.Indent)
+}
+
+// patchOp is a single JSON Patch operation
+type patchOp struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+func (op patchOp) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{"op": op.Op, "path": op.Path}
+	if op.Op != "remove" {
+		m["value"] = op.Value
+	}
+	return json.Marshal(m)
+}
+
+// jsonPatch returns the operations turning old into new when applied in
+// order. A nil value is an absent document, which is added or removed
+// whole.
+func jsonPatch(old, new interface{}) []patchOp {
+	var ops []patchOp
+	switch {
+	case old == nil && new == nil:
+		return ops
+	case old == nil:
+		return append(ops, patchOp{Op: "add", Path: "", Value: new})
+	case new == nil:
+		return append(ops, patchOp{Op: "remove", Path: ""})
+	}
+	appendPatch(&ops, "", old, new)
+	return ops
+}
+
+func appendPatch(ops *[]patchOp, path string, old, new interface{}) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if n, ok := new.(map[string]interface{}); ok {
+			appendMapPatch(ops, path, o, n)
+			return
+		}
+	case []interface{}:
+		if n, ok := new.([]interface{}); ok {
+			appendListPatch(ops, path, o, n)
+			return
+		}
+	}
+	if !valuesEqual(old, new) {
+		*ops = append(*ops, patchOp{Op: "replace", Path: path, Value: new})
+	}
+}
+
+func appendMapPatch(ops *[]patchOp, path string, old, new map[string]interface{}) {
+	keys := make([]string, 0, len(old)+len(new))
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		childPath := path + "/" + escapePointer(k)
+		oldValue, inOld := old[k]
+		newValue, inNew := new[k]
+		switch {
+		case !inOld:
+			*ops = append(*ops, patchOp{Op: "add", Path: childPath, Value: newValue})
+		case !inNew:
+			*ops = append(*ops, patchOp{Op: "remove", Path: childPath})
+		default:
+			appendPatch(ops, childPath, oldValue, newValue)
+		}
+	}
+}
+
+// appendListPatch aligns list elements with a minimal edit script. While
+// the operations are applied, the list always starts with the already
+// patched prefix of new, so positions are indexes into new.
+func appendListPatch(ops *[]patchOp, path string, old, new []interface{}) {
+	table := make(symbolTable)
+	removed, inserted := editScript(table.symbols(serializeElements(old)), table.symbols(serializeElements(new)))
+
+	indexPath := func(i int) string {
+		return path + "/" + strconv.Itoa(i)
+	}
+
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		if !(i < len(old) && removed[i]) && !(j < len(new) && inserted[j]) {
+			i++
+			j++
+			continue
+		}
+
+		start, oldStart := j, i
+		for i < len(old) && removed[i] {
+			i++
+		}
+		for j < len(new) && inserted[j] {
+			j++
+		}
+		oldCount, newCount := i-oldStart, j-start
+
+		paired := min(oldCount, newCount)
+		for k := 0; k < paired; k++ {
+			appendPatch(ops, indexPath(start+k), old[oldStart+k], new[start+k])
+		}
+		for k := paired; k < oldCount; k++ {
+			*ops = append(*ops, patchOp{Op: "remove", Path: indexPath(start + paired)})
+		}
+		for k := paired; k < newCount; k++ {
+			*ops = append(*ops, patchOp{Op: "add", Path: indexPath(start + k), Value: new[start+k]})
+		}
+	}
+}
+
+// escapePointer escapes a JSON Pointer reference token
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+func valuesEqual(a, b interface{}) bool {
+	aj, errA := json.Marshal(a)
+	bj, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aj) == string(bj)
+}
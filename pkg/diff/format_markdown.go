@@ -0,0 +1,85 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MarkdownFormatter writes GitHub-flavoured Markdown suitable for pull
+// request comments: a summary table followed by a collapsible section with
+// the unified diff of every changed resource
+type MarkdownFormatter struct {
+	// Title is written as the heading; it defaults to "Manifest diff"
+	Title string
+}
+
+func (f MarkdownFormatter) Format(w io.Writer, result *DiffResult) error {
+	var sb strings.Builder
+
+	title := f.Title
+	if title == "" {
+		title = "Manifest diff"
+	}
+	fmt.Fprintf(&sb, "### %s\n\n", title)
+
+	if !result.HasDifferences() {
+		sb.WriteString("No differences.\n")
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	secs := sections(result)
+	if len(result.Resources()) > 0 {
+		fmt.Fprintf(&sb, "%s\n\n", summary(result.Stats()))
+		sb.WriteString("| Resource | Change | Lines |\n")
+		sb.WriteString("| --- | --- | --- |\n")
+		for _, sec := range secs {
+			if sec.change == Unchanged {
+				continue
+			}
+			fmt.Fprintf(&sb, "| `%s` | %s | %s |\n", escapeTableCell(sec.title()), escapeTableCell(sec.description()), lineCounts(sec.result))
+		}
+		sb.WriteString("\n")
+	}
+
+	for _, sec := range secs {
+		if sec.change == Unchanged {
+			continue
+		}
+		fence := codeFence(sec.result.String())
+		fmt.Fprintf(&sb, "<details>\n<summary><code>%s</code> %s (%s)</summary>\n\n", escapeHTML(sec.title()), escapeHTML(sec.description()), lineCounts(sec.result))
+		fmt.Fprintf(&sb, "%sdiff\n%s\n%s\n\n</details>\n\n", fence, sec.result.String(), fence)
+	}
+
+	_, err := io.WriteString(w, strings.TrimSuffix(sb.String(), "\n"))
+	return err
+}
+
+// lineCounts formats the added and removed line counts of a result
+func lineCounts(result *DiffResult) string {
+	stats := result.Stats()
+	return fmt.Sprintf("+%d -%d", stats.LinesAdded, stats.LinesRemoved)
+}
+
+// codeFence returns a backtick fence longer than any backtick run in s
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func escapeTableCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func escapeHTML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,358 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// DefaultTerminalWidth is the width assumed for side-by-side output when
+// the terminal size cannot be determined
+const DefaultTerminalWidth = 80
+
+// ANSI escape sequences used by TerminalFormatter
+const (
+	ansiReset      = "\x1b[0m"
+	ansiBold       = "\x1b[1m"
+	ansiRed        = "\x1b[31m"
+	ansiGreen      = "\x1b[32m"
+	ansiCyan       = "\x1b[36m"
+	ansiReverse    = "\x1b[7m"
+	ansiReverseOff = "\x1b[27m"
+)
+
+const (
+	sideBySideGap  = " │ "
+	ellipsis       = "…"
+	minColumnWidth = 8
+)
+
+// TerminalFormatter writes a diff for reading in a terminal, either as a
+// unified diff or as two columns side by side. With Color set, removed and
+// added lines are coloured and the changed part of a modified line is
+// highlighted.
+type TerminalFormatter struct {
+	Color      bool
+	SideBySide bool
+	// Width is the total width of side-by-side output; it defaults to
+	// DefaultTerminalWidth
+	Width int
+}
+
+// NewTerminalFormatter returns a TerminalFormatter configured for w:
+// colour is enabled only when w is a terminal and NO_COLOR is not set, and
+// the width is taken from COLUMNS or the terminal size
+func NewTerminalFormatter(w io.Writer, sideBySide bool) TerminalFormatter {
+	return TerminalFormatter{
+		Color:      colorEnabled(w),
+		SideBySide: sideBySide,
+		Width:      terminalWidth(w),
+	}
+}
+
+// colorEnabled reports whether coloured output should be written to w.
+// See https://no-color.org for the NO_COLOR convention.
+func colorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// terminalWidth returns the width of the terminal w writes to, preferring
+// an explicit COLUMNS setting
+func terminalWidth(w io.Writer) int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if f, ok := w.(*os.File); ok {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	return DefaultTerminalWidth
+}
+
+func (f TerminalFormatter) Format(w io.Writer, result *DiffResult) error {
+	if !result.HasDifferences() {
+		return nil
+	}
+
+	var sb strings.Builder
+	for _, sec := range sections(result) {
+		if sec.change == Unchanged {
+			continue
+		}
+		if f.SideBySide {
+			f.writeSideBySide(&sb, sec)
+		} else {
+			f.writeUnified(&sb, sec)
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeUnified writes a section as a unified diff
+func (f TerminalFormatter) writeUnified(sb *strings.Builder, sec section) {
+	result := sec.result
+	if result.oldLabel != "" || result.newLabel != "" {
+		sb.WriteString(f.paint(ansiBold, "--- "+result.oldLabel) + "\n")
+		sb.WriteString(f.paint(ansiBold, "+++ "+result.newLabel) + "\n")
+	}
+
+	for _, h := range result.hunks {
+		spans := f.intraLineSpans(h)
+		sb.WriteString(f.paint(ansiCyan, h.Header()) + "\n")
+		for i := range h.Lines {
+			line := &h.Lines[i]
+			text := string(line.Op) + line.Text
+			switch line.Op {
+			case '-':
+				text = f.highlight(ansiRed, text, shiftSpans(spans[line], 1))
+			case '+':
+				text = f.highlight(ansiGreen, text, shiftSpans(spans[line], 1))
+			}
+			sb.WriteString(text + "\n")
+			if line.NoNewline {
+				sb.WriteString(noNewlineMarker + "\n")
+			}
+		}
+	}
+}
+
+// writeSideBySide writes a section as two columns, the old lines on the
+// left and the new lines on the right
+func (f TerminalFormatter) writeSideBySide(sb *strings.Builder, sec section) {
+	width := f.Width
+	if width <= 0 {
+		width = DefaultTerminalWidth
+	}
+
+	switch {
+	case sec.id != nil:
+		sb.WriteString(f.paint(ansiBold, fmt.Sprintf("%s (%s)", sec.title(), sec.description())) + "\n")
+	case sec.result.oldLabel != "" || sec.result.newLabel != "":
+		sb.WriteString(f.paint(ansiBold, sec.result.oldLabel+" -> "+sec.result.newLabel) + "\n")
+	}
+
+	for _, h := range sec.result.hunks {
+		numWidth := len(strconv.Itoa(max(h.OldStart+h.OldLines, h.NewStart+h.NewLines)))
+		columnWidth := max((width-utf8.RuneCountInString(sideBySideGap))/2-numWidth-3, minColumnWidth)
+
+		sb.WriteString(f.paint(ansiCyan, h.Header()) + "\n")
+		for _, row := range sideBySideRows(h) {
+			var oldSpans, newSpans []span
+			var oldText, newText string
+			if row.old != nil {
+				oldText, oldSpans = expandSegments(row.old)
+			}
+			if row.new != nil {
+				newText, newSpans = expandSegments(row.new)
+			}
+			if row.old != nil && row.new != nil && row.old.Op != ' ' && row.old.Segments == nil {
+				oldSpans, newSpans = changedSpans(oldText, newText)
+			}
+
+			line := f.column(row.old, true, oldText, oldSpans, numWidth, columnWidth) +
+				sideBySideGap +
+				f.column(row.new, false, newText, newSpans, numWidth, columnWidth)
+			sb.WriteString(strings.TrimRight(line, " ") + "\n")
+		}
+	}
+}
+
+// column renders one side of a side-by-side row: the line number, the
+// operation and the text truncated to width. The left column is padded to
+// its full width so that the right column lines up.
+func (f TerminalFormatter) column(line *Line, left bool, text string, spans []span, numWidth, width int) string {
+	if line == nil {
+		return strings.Repeat(" ", numWidth+3+width)
+	}
+
+	number, color := line.NewNumber, ansiGreen
+	if left {
+		number, color = line.OldNumber, ansiRed
+	}
+
+	text, spans = truncate(text, spans, width)
+	padding := ""
+	if left {
+		padding = strings.Repeat(" ", width-utf8.RuneCountInString(text))
+	}
+	if line.Op != ' ' {
+		text = f.highlight(color, text, spans)
+	}
+	return fmt.Sprintf("%*d %c %s%s", numWidth, number, line.Op, text, padding)
+}
+
+// paint wraps text in the given style when colour is enabled
+func (f TerminalFormatter) paint(style, text string) string {
+	if !f.Color {
+		return text
+	}
+	return style + text + ansiReset
+}
+
+// highlight colours text and reverses the colours of the given spans,
+// which are byte ranges in ascending order
+func (f TerminalFormatter) highlight(style, text string, spans []span) string {
+	if !f.Color {
+		return text
+	}
+
+	var sb strings.Builder
+	sb.WriteString(style)
+	last := 0
+	for _, s := range spans {
+		sb.WriteString(text[last:s.start])
+		sb.WriteString(ansiReverse + text[s.start:s.end] + ansiReverseOff)
+		last = s.end
+	}
+	sb.WriteString(text[last:])
+	sb.WriteString(ansiReset)
+	return sb.String()
+}
+
+// intraLineSpans pairs the removed and added lines of a hunk the same way
+// the side-by-side view does and returns the changed spans of each line.
+// Lines refined with WithIntraLineDiff use their segments; other pairs
+// are highlighted between their common prefix and suffix.
+func (f TerminalFormatter) intraLineSpans(h Hunk) map[*Line][]span {
+	if !f.Color {
+		return nil
+	}
+	spans := make(map[*Line][]span)
+	for _, row := range sideBySideRows(h) {
+		if row.old == nil || row.new == nil || row.old.Op == ' ' {
+			continue
+		}
+		if row.old.Segments != nil {
+			spans[row.old], spans[row.new] = segmentSpans(row.old.Segments), segmentSpans(row.new.Segments)
+			continue
+		}
+		spans[row.old], spans[row.new] = changedSpans(row.old.Text, row.new.Text)
+	}
+	return spans
+}
+
+// span is a byte range of a line
+type span struct {
+	start, end int
+}
+
+// changedSpans returns the part of old and new that differs once their
+// common prefix and suffix are removed. Lines with nothing in common have
+// no spans, as highlighting the whole line would add nothing.
+func changedSpans(old, new string) ([]span, []span) {
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) {
+		r, size := utf8.DecodeRuneInString(old[prefix:])
+		if n, _ := utf8.DecodeRuneInString(new[prefix:]); r != n {
+			break
+		}
+		prefix += size
+	}
+
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix {
+		r, size := utf8.DecodeLastRuneInString(old[:len(old)-suffix])
+		if n, _ := utf8.DecodeLastRuneInString(new[:len(new)-suffix]); r != n {
+			break
+		}
+		suffix += size
+	}
+
+	if prefix == 0 && suffix == 0 {
+		return nil, nil
+	}
+
+	var oldSpans, newSpans []span
+	if prefix < len(old)-suffix {
+		oldSpans = []span{{prefix, len(old) - suffix}}
+	}
+	if prefix < len(new)-suffix {
+		newSpans = []span{{prefix, len(new) - suffix}}
+	}
+	return oldSpans, newSpans
+}
+
+// shiftSpans returns spans moved right by n bytes
+func shiftSpans(spans []span, n int) []span {
+	shifted := make([]span, len(spans))
+	for i, s := range spans {
+		shifted[i] = span{s.start + n, s.end + n}
+	}
+	return shifted
+}
+
+// truncate shortens text to at most width runes, replacing the tail with
+// an ellipsis, and clips spans to the remaining text
+func truncate(text string, spans []span, width int) (string, []span) {
+	if utf8.RuneCountInString(text) <= width {
+		return text, spans
+	}
+
+	cut := 0
+	for i := 0; i < width-1; i++ {
+		_, size := utf8.DecodeRuneInString(text[cut:])
+		cut += size
+	}
+
+	var clipped []span
+	for _, s := range spans {
+		if s.start >= cut {
+			break
+		}
+		clipped = append(clipped, span{s.start, min(s.end, cut)})
+	}
+	return text[:cut] + ellipsis, clipped
+}
+
+// expandSegments returns the text of a line with tabs expanded, and the
+// spans of its changed segments within the expanded text
+func expandSegments(line *Line) (string, []span) {
+	if line.Segments == nil {
+		text, _ := expandTabs(line.Text, 0)
+		return text, nil
+	}
+	expanded := make([]Segment, len(line.Segments))
+	col := 0
+	for i, seg := range line.Segments {
+		expanded[i] = seg
+		expanded[i].Text, col = expandTabs(seg.Text, col)
+	}
+	var sb strings.Builder
+	for _, seg := range expanded {
+		sb.WriteString(seg.Text)
+	}
+	return sb.String(), segmentSpans(expanded)
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of eight
+// columns so that side-by-side columns stay aligned. s starts at column
+// col; the column following it is returned.
+func expandTabs(s string, col int) (string, int) {
+	if !strings.Contains(s, "\t") {
+		return s, col + utf8.RuneCountInString(s)
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if r == '\t' {
+			n := 8 - col%8
+			sb.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		sb.WriteRune(r)
+		col++
+	}
+	return sb.String(), col
+}
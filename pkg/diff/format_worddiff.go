@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"io"
+	"strings"
+)
+
+// WordDiffFormatter writes the diff in the style of git's plain word diff:
+// each removed line paired with an added line is written once, with the
+// removed words marked [-like this-] and the added words {+like this+}.
+// Lines refined with WithIntraLineDiff keep their granularity; other pairs
+// are refined by word.
+type WordDiffFormatter struct{}
+
+func (WordDiffFormatter) Format(w io.Writer, result *DiffResult) error {
+	if !result.HasDifferences() {
+		return nil
+	}
+
+	var sb strings.Builder
+	for _, sec := range sections(result) {
+		if sec.change == Unchanged {
+			continue
+		}
+		if sec.result.oldLabel != "" || sec.result.newLabel != "" {
+			sb.WriteString("--- " + sec.result.oldLabel + "\n")
+			sb.WriteString("+++ " + sec.result.newLabel + "\n")
+		}
+		for _, h := range sec.result.hunks {
+			sb.WriteString(h.Header() + "\n")
+			for _, row := range sideBySideRows(h) {
+				sb.WriteString(wordDiffRow(row) + "\n")
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// wordDiffRow renders one side-by-side row as a single word diff line
+func wordDiffRow(row sideBySideRow) string {
+	switch {
+	case row.new == nil:
+		return formatSegments([]Segment{{Op: '-', Text: row.old.Text}}, false)
+	case row.old == nil:
+		return formatSegments([]Segment{{Op: '+', Text: row.new.Text}}, false)
+	case row.old.Op == ' ':
+		return row.old.Text
+	}
+
+	segments := mergeSegments(row.old.Segments, row.new.Segments)
+	if row.old.Segments == nil {
+		segments = refine(row.old.Text, row.new.Text, WordGranularity)
+	}
+	if segments == nil {
+		segments = []Segment{{Op: '-', Text: row.old.Text}, {Op: '+', Text: row.new.Text}}
+	}
+	return formatSegments(segments, false)
+}
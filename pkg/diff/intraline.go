@@ -0,0 +1,230 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Granularity selects how far substituted lines are refined into
+// intra-line edits
+type Granularity int
+
+const (
+	// LineGranularity reports substituted lines as whole-line edits
+	LineGranularity Granularity = iota
+	// WordGranularity compares words, runs of whitespace and punctuation
+	// characters, so a changed image tag is reported as the tag alone
+	WordGranularity
+	// CharGranularity compares single characters, for changes inside long
+	// tokens such as hashes or encoded blobs
+	CharGranularity
+)
+
+// Segment is a run of text within a line or string value that is
+// unchanged (Op ' '), removed ('-') or added ('+')
+type Segment struct {
+	Op   rune
+	Text string
+}
+
+// elideContext is the number of characters kept on either side of a change
+// when long unchanged segments are shortened for display
+const elideContext = 20
+
+// refineHunks pairs the removed and added lines of every change the same
+// way the side-by-side view does and splits each pair into segments
+func (d *Diff) refineHunks(hunks []Hunk) {
+	if d.intraLine == LineGranularity {
+		return
+	}
+	for _, h := range hunks {
+		for _, row := range sideBySideRows(h) {
+			if row.old == nil || row.new == nil || row.old.Op == ' ' {
+				continue
+			}
+			row.old.Segments, row.new.Segments = splitSegments(refine(row.old.Text, row.new.Text, d.intraLine))
+		}
+	}
+}
+
+// refine returns the edits turning old into new at the given granularity,
+// removals preceding additions within each change. Strings with nothing in
+// common are not refined, as segments would add nothing to a whole-line
+// edit, and nil is returned.
+func refine(old, new string, granularity Granularity) []Segment {
+	oldTokens := tokenize(old, granularity)
+	newTokens := tokenize(new, granularity)
+
+	table := make(symbolTable)
+	removed, inserted := editScript(table.symbols(oldTokens), table.symbols(newTokens))
+
+	var segments []Segment
+	common := false
+	appendToken := func(op rune, text string) {
+		if n := len(segments); n > 0 && segments[n-1].Op == op {
+			segments[n-1].Text += text
+			return
+		}
+		segments = append(segments, Segment{Op: op, Text: text})
+	}
+
+	i, j := 0, 0
+	for i < len(oldTokens) || j < len(newTokens) {
+		switch {
+		case i < len(oldTokens) && removed[i]:
+			appendToken('-', oldTokens[i])
+			i++
+		case j < len(newTokens) && inserted[j]:
+			appendToken('+', newTokens[j])
+			j++
+		default:
+			if strings.TrimSpace(oldTokens[i]) != "" {
+				common = true
+			}
+			appendToken(' ', oldTokens[i])
+			i++
+			j++
+		}
+	}
+
+	if !common {
+		return nil
+	}
+	return segments
+}
+
+// tokenize splits s into the units compared at the given granularity
+func tokenize(s string, granularity Granularity) []string {
+	var tokens []string
+	if granularity == CharGranularity {
+		for _, r := range s {
+			tokens = append(tokens, string(r))
+		}
+		return tokens
+	}
+
+	class := func(r rune) int {
+		switch {
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		default:
+			// Punctuation separates words and is compared on its own
+			return 0
+		}
+	}
+
+	start := 0
+	for start < len(s) {
+		r, size := utf8.DecodeRuneInString(s[start:])
+		end := start + size
+		if c := class(r); c != 0 {
+			for end < len(s) {
+				next, size := utf8.DecodeRuneInString(s[end:])
+				if class(next) != c {
+					break
+				}
+				end += size
+			}
+		}
+		tokens = append(tokens, s[start:end])
+		start = end
+	}
+	return tokens
+}
+
+// splitSegments splits a combined edit into the segments of the old text
+// and the segments of the new text
+func splitSegments(segments []Segment) ([]Segment, []Segment) {
+	if segments == nil {
+		return nil, nil
+	}
+	var old, new []Segment
+	for _, seg := range segments {
+		if seg.Op != '+' {
+			old = append(old, seg)
+		}
+		if seg.Op != '-' {
+			new = append(new, seg)
+		}
+	}
+	return old, new
+}
+
+// mergeSegments is the inverse of splitSegments: it interleaves the
+// segments of a removed and an added line, which share their unchanged
+// segments, back into a single edit
+func mergeSegments(old, new []Segment) []Segment {
+	var merged []Segment
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		for ; i < len(old) && old[i].Op != ' '; i++ {
+			merged = append(merged, old[i])
+		}
+		for ; j < len(new) && new[j].Op != ' '; j++ {
+			merged = append(merged, new[j])
+		}
+		if i < len(old) && j < len(new) {
+			merged = append(merged, old[i])
+			i++
+			j++
+		}
+	}
+	return merged
+}
+
+// segmentSpans returns the byte ranges of the changed segments within the
+// text the segments make up
+func segmentSpans(segments []Segment) []span {
+	var spans []span
+	pos := 0
+	for _, seg := range segments {
+		if seg.Op != ' ' {
+			spans = append(spans, span{pos, pos + len(seg.Text)})
+		}
+		pos += len(seg.Text)
+	}
+	return spans
+}
+
+// formatSegments renders an edit in the style of git's plain word diff,
+// [-removed-]{+added+}. With elide set, long unchanged segments are
+// shortened to the characters around the changes.
+func formatSegments(segments []Segment, elide bool) string {
+	var sb strings.Builder
+	for i, seg := range segments {
+		switch seg.Op {
+		case '-':
+			sb.WriteString("[-" + seg.Text + "-]")
+		case '+':
+			sb.WriteString("{+" + seg.Text + "+}")
+		default:
+			text := seg.Text
+			if elide {
+				text = elideText(text, i > 0, i < len(segments)-1)
+			}
+			sb.WriteString(text)
+		}
+	}
+	return sb.String()
+}
+
+// elideText shortens s to the characters next to the changes around it:
+// its head when a change precedes it and its tail when one follows
+func elideText(s string, keepHead, keepTail bool) string {
+	runes := []rune(s)
+	if len(runes) <= 2*elideContext+1 {
+		return s
+	}
+	var sb strings.Builder
+	if keepHead {
+		sb.WriteString(string(runes[:elideContext]))
+	}
+	sb.WriteString(ellipsis)
+	if keepTail {
+		sb.WriteString(string(runes[len(runes)-elideContext:]))
+	}
+	return sb.String()
+}
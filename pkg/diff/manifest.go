@@ -0,0 +1,342 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChangeType describes how a resource differs between two sets of manifests
+type ChangeType string
+
+const (
+	Added     ChangeType = "added"
+	Removed   ChangeType = "removed"
+	Modified  ChangeType = "modified"
+	Renamed   ChangeType = "renamed"
+	Unchanged ChangeType = "unchanged"
+)
+
+// ResourceID identifies a Kubernetes resource within a set of manifests
+type ResourceID struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+}
+
+// String returns the resource identity as Kind/name, prefixed with the
+// namespace when one is set
+func (id ResourceID) String() string {
+	s := id.Kind + "/" + id.Name
+	if id.Namespace != "" {
+		s = id.Namespace + "/" + s
+	}
+	return s
+}
+
+// ResourceDiff is the comparison result for a single resource
+type ResourceDiff struct {
+	ID     ResourceID
+	Change ChangeType
+	// From is the identity in the old manifests of a renamed resource, and
+	// Similarity the share of lines the two documents have in common
+	From       *ResourceID
+	Similarity float64
+	Result     *DiffResult
+}
+
+// manifest is a single YAML document parsed from a multi-document stream
+type manifest struct {
+	id        ResourceID
+	text      string
+	node      *yaml.Node // nil when the document is empty
+	rewritten bool       // node no longer matches text
+}
+
+// CompareMultipleManifests compares two multi-document YAML streams
+// resource by resource, matching documents by apiVersion, kind, namespace
+// and name rather than by their position in the stream. Resources left
+// unmatched are paired up as renames when their content is similar enough;
+// see WithRenameThreshold.
+func (d *Diff) CompareMultipleManifests(oldManifests, newManifests string) (*DiffResult, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	oldDocs, err := d.parseManifests(oldManifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse old manifests: %w", err)
+	}
+	newDocs, err := d.parseManifests(newManifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new manifests: %w", err)
+	}
+
+	// Pair documents by identity; duplicates are matched in order
+	newByID := make(map[ResourceID][]int)
+	for i, doc := range newDocs {
+		newByID[doc.id] = append(newByID[doc.id], i)
+	}
+	pairs := make([]int, len(oldDocs))
+	matched := make([]bool, len(newDocs))
+	for i, oldDoc := range oldDocs {
+		pairs[i] = -1
+		if candidates := newByID[oldDoc.id]; len(candidates) > 0 {
+			pairs[i] = candidates[0]
+			newByID[oldDoc.id] = candidates[1:]
+			matched[candidates[0]] = true
+		}
+	}
+	renames, err := d.detectRenames(oldDocs, newDocs, pairs, matched)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []ResourceDiff
+	for i, oldDoc := range oldDocs {
+		if pairs[i] < 0 {
+			result, err := d.compareResource(oldDoc.id, Removed, oldDoc, manifest{})
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, ResourceDiff{ID: oldDoc.id, Change: Removed, Result: result})
+			continue
+		}
+
+		newDoc := newDocs[pairs[i]]
+		if similarity, ok := renames[i]; ok {
+			result, err := d.compareResource(newDoc.id, Renamed, oldDoc, newDoc)
+			if err != nil {
+				return nil, err
+			}
+			from := oldDoc.id
+			resources = append(resources, ResourceDiff{ID: newDoc.id, Change: Renamed, From: &from, Similarity: similarity, Result: result})
+			continue
+		}
+
+		result, err := d.compareResource(oldDoc.id, Modified, oldDoc, newDoc)
+		if err != nil {
+			return nil, err
+		}
+		change := Modified
+		if !result.HasDifferences() {
+			change = Unchanged
+		}
+		resources = append(resources, ResourceDiff{ID: oldDoc.id, Change: change, Result: result})
+	}
+
+	for i, newDoc := range newDocs {
+		if matched[i] {
+			continue
+		}
+		result, err := d.compareResource(newDoc.id, Added, manifest{}, newDoc)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, ResourceDiff{ID: newDoc.id, Change: Added, Result: result})
+	}
+
+	return d.combineResources(resources), nil
+}
+
+// compareResource diffs a single resource, labelling the unified diff
+// file headers with the identity of each side
+func (d *Diff) compareResource(id ResourceID, change ChangeType, oldDoc, newDoc manifest) (*DiffResult, error) {
+	oldLabel := resourceLabel(d.oldLabel, oldDoc.id)
+	newLabel := resourceLabel(d.newLabel, newDoc.id)
+	switch change {
+	case Added:
+		oldLabel = devNull
+	case Removed:
+		newLabel = devNull
+	}
+
+	result, err := d.compareDocuments(oldDoc, newDoc, oldLabel, newLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %s: %w", id, err)
+	}
+	return result, nil
+}
+
+// resourceLabel builds a file header label for a resource, prefixed with
+// the configured label when one is set
+func resourceLabel(prefix string, id ResourceID) string {
+	if prefix == "" {
+		return id.String()
+	}
+	return prefix + "/" + id.String()
+}
+
+// combineResources builds the aggregate result for a multi-manifest comparison
+func (d *Diff) combineResources(resources []ResourceDiff) *DiffResult {
+	differences := false
+	var outputs []string
+	for _, res := range resources {
+		if res.Change == Unchanged {
+			continue
+		}
+		differences = true
+		// A renamed resource may have no differences left once ignore
+		// rules are applied
+		if res.Result.HasDifferences() {
+			outputs = append(outputs, res.Result.String())
+		}
+	}
+
+	return &DiffResult{
+		differences: differences,
+		output:      strings.Join(outputs, "\n"),
+		resources:   resources,
+	}
+}
+
+// changeDescription describes how a resource changed, naming the old
+// identity of a renamed resource
+func changeDescription(change ChangeType, from *ResourceID) string {
+	if change == Renamed && from != nil {
+		return fmt.Sprintf("renamed from %s", from)
+	}
+	return string(change)
+}
+
+// parseManifests splits a multi-document YAML stream and prepares every
+// non-empty document for comparison
+func (d *Diff) parseManifests(s string) ([]manifest, error) {
+	var manifests []manifest
+
+	for i, doc := range splitDocuments(s) {
+		m, err := d.parseManifest(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		// Skip documents that only contain comments or whitespace
+		if m.node == nil {
+			continue
+		}
+		manifests = append(manifests, m)
+	}
+
+	return manifests, nil
+}
+
+// parseManifest parses a single YAML document and prepares it for
+// comparison
+func (d *Diff) parseManifest(doc string) (manifest, error) {
+	m, err := parseManifest(doc)
+	if err != nil || m.node == nil {
+		return m, err
+	}
+	d.prepare(&m)
+	return m, nil
+}
+
+// prepare rewrites a parsed manifest according to the configured rules
+// before it is compared
+func (d *Diff) prepare(m *manifest) {
+	if d.normalize(m) {
+		m.rewritten = true
+	}
+	if d.removeIgnoredFields(m) {
+		m.rewritten = true
+	}
+	if d.maskSensitiveFields(m) {
+		m.rewritten = true
+	}
+}
+
+// encode renders the node of a rewritten manifest as text, ending in a
+// line break when the source text does
+func (m manifest) encode() (string, error) {
+	text, err := encodeNode(m.node)
+	if err != nil || text == "" || !strings.HasSuffix(m.text, "\n") {
+		return text, err
+	}
+	return text + "\n", nil
+}
+
+// parseManifest parses a single YAML document and extracts its identity
+func parseManifest(doc string) (manifest, error) {
+	m := manifest{text: doc}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &node); err != nil {
+		return m, err
+	}
+	if len(node.Content) == 0 {
+		return m, nil
+	}
+	m.node = &node
+
+	var meta struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+		Metadata   struct {
+			Name      string `yaml:"name"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"metadata"`
+	}
+	// Documents that are not mappings have no identity but can still be diffed
+	if node.Content[0].Kind == yaml.MappingNode {
+		if err := node.Decode(&meta); err != nil {
+			return m, err
+		}
+	}
+
+	m.id = ResourceID{
+		APIVersion: meta.APIVersion,
+		Kind:       meta.Kind,
+		Namespace:  meta.Metadata.Namespace,
+		Name:       meta.Metadata.Name,
+	}
+	return m, nil
+}
+
+// value decodes the manifest into generic maps, slices and scalars.
+// Empty documents decode to nil.
+func (m manifest) value() (interface{}, error) {
+	if m.node == nil {
+		return nil, nil
+	}
+	var v interface{}
+	if err := m.node.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// splitDocuments splits a YAML stream on document separator lines. Every
+// document ends with a newline, whether or not the stream does.
+func splitDocuments(s string) []string {
+	var documents []string
+	var current []string
+
+	flush := func() {
+		doc := strings.TrimSpace(strings.Join(current, "\n"))
+		if doc != "" {
+			documents = append(documents, doc+"\n")
+		}
+		current = current[:0]
+	}
+
+	for _, line := range strings.Split(s, "\n") {
+		if isDocumentSeparator(line) {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+
+	return documents
+}
+
+// isDocumentSeparator reports whether line starts a new YAML document
+func isDocumentSeparator(line string) bool {
+	line = strings.TrimRight(line, " \t\r")
+	if !strings.HasPrefix(line, "---") {
+		return false
+	}
+	return len(line) == 3 || line[3] == ' ' || line[3] == '\t'
+}
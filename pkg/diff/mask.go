@@ -0,0 +1,186 @@
+package diff
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedPrefix starts every redaction marker. A marker carries a keyed
+// hash of the original value, so equal values produce equal markers within
+// a Diff and a changed value shows up as a changed marker.
+const redactedPrefix = "<redacted:"
+
+// DefaultMaskRules select the values of Secret resources. They also apply
+// to Secrets among the items of list resources such as List and SecretList.
+var DefaultMaskRules = []FieldRule{
+	{
+		Kind: "Secret",
+		Paths: []string{
+			"data.*",
+			"stringData.*",
+			`metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`,
+		},
+	},
+}
+
+// newMaskKey returns a random key for hashing masked values. The key is
+// never exposed, so markers cannot be used to guess the original values.
+func newMaskKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("diff: failed to generate mask key: " + err.Error())
+	}
+	return key
+}
+
+// kindPattern finds the kinds named in a manifest that is not valid YAML
+var kindPattern = regexp.MustCompile(`(?m)\bkind:\s*["']?([A-Za-z0-9]+)`)
+
+// mayHoldMasked reports whether text that is not valid YAML could hold
+// values selected by the mask rules: a kind they cover is named in it, as
+// a resource or as a list of them, or a rule covers every kind
+func (d *Diff) mayHoldMasked(text string) bool {
+	selectors := d.mask
+	if d.maskSecrets {
+		selectors = append(append([]fieldSelector(nil), d.secretMask...), selectors...)
+	}
+	kinds := kindPattern.FindAllStringSubmatch(text, -1)
+	for _, sel := range selectors {
+		if sel.kind == nil {
+			return true
+		}
+		for _, kind := range kinds {
+			if sel.kind.MatchString(kind[1]) || sel.kind.MatchString(strings.TrimSuffix(kind[1], "List")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maskSensitiveFields replaces the values selected by the mask rules with
+// redaction markers, reporting whether anything was replaced
+func (d *Diff) maskSensitiveFields(m *manifest) bool {
+	masked := d.maskNode(m.node, m.id)
+
+	// The items of a List, such as kubectl get -o yaml prints, are masked
+	// like the resources they are. The items of a typed list such as
+	// SecretList usually have no kind of their own.
+	if strings.HasSuffix(m.id.Kind, "List") {
+		items := mappingValue(m.node.Content[0], "items")
+		if items != nil && items.Kind == yaml.SequenceNode {
+			for _, item := range items.Content {
+				if d.maskNode(item, listItemID(m.id, item)) {
+					masked = true
+				}
+			}
+		}
+	}
+	return masked
+}
+
+// listItemID returns the identity of an item of a list resource
+func listItemID(list ResourceID, item *yaml.Node) ResourceID {
+	id := ResourceID{Kind: strings.TrimSuffix(list.Kind, "List")}
+	if kind := mappingValue(item, "kind"); kind != nil {
+		id.Kind = kind.Value
+	}
+	if apiVersion := mappingValue(item, "apiVersion"); apiVersion != nil {
+		id.APIVersion = apiVersion.Value
+	}
+	metadata := mappingValue(item, "metadata")
+	if name := mappingValue(metadata, "name"); name != nil {
+		id.Name = name.Value
+	}
+	if namespace := mappingValue(metadata, "namespace"); namespace != nil {
+		id.Namespace = namespace.Value
+	}
+	return id
+}
+
+// maskNode redacts the values below node selected by the mask rules that
+// cover the resource id, reporting whether anything was replaced
+func (d *Diff) maskNode(root *yaml.Node, id ResourceID) bool {
+	selectors := applicableSelectors(d.mask, id)
+	if d.maskSecrets {
+		selectors = append(applicableSelectors(d.secretMask, id), selectors...)
+	}
+	if len(selectors) == 0 {
+		return false
+	}
+
+	keys := mappingKeys(root)
+	masked := false
+	walkNode(root, nil, d.mergeKeys, func(path []pathSegment, node *yaml.Node) bool {
+		for _, sel := range selectors {
+			if sel.matches(path) {
+				d.redactNode(node)
+				// Comments on the key may quote the value as well
+				if key, ok := keys[node]; ok {
+					key.HeadComment, key.LineComment, key.FootComment = "", "", ""
+				}
+				masked = true
+				return false
+			}
+		}
+		return false
+	})
+	return masked
+}
+
+// mappingKeys returns the key node of every mapping value below node
+func mappingKeys(node *yaml.Node) map[*yaml.Node]*yaml.Node {
+	keys := make(map[*yaml.Node]*yaml.Node)
+	var walk func(*yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				keys[n.Content[i+1]] = n.Content[i]
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(node)
+	return keys
+}
+
+// redactNode replaces node in place with a scalar redaction marker. Whole
+// mappings and sequences are redacted as a single value so that neither
+// their keys nor their values are revealed. The comments of the node are
+// dropped, as they may quote the value.
+func (d *Diff) redactNode(node *yaml.Node) {
+	var value string
+	if node.Kind == yaml.ScalarNode {
+		value = node.Value
+	} else {
+		encoded, err := encodeNode(node)
+		if err != nil {
+			encoded = node.Value
+		}
+		value = encoded
+	}
+
+	mac := hmac.New(sha256.New, d.maskKey)
+	mac.Write([]byte(value))
+	marker := redactedPrefix + hex.EncodeToString(mac.Sum(nil)[:8]) + ">"
+
+	*node = yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: marker,
+	}
+}
+
+// isRedacted reports whether v is a redaction marker
+func isRedacted(v interface{}) bool {
+	s, ok := v.(string)
+	return ok && strings.HasPrefix(s, redactedPrefix) && strings.HasSuffix(s, ">")
+}
@@ -0,0 +1,67 @@
+package diff
+
+import "strings"
+
+// MergeKeys maps list fields to the element fields that identify list
+// elements, in order of preference. The first field that is present with
+// a distinct value on every element of both lists is used for matching.
+//
+// Entries are keyed either by field name, such as "env", or by a dotted
+// path without list selectors, such as "spec.endpoints". A path entry
+// takes precedence over a field name entry.
+type MergeKeys map[string][]string
+
+// DefaultMergeKeys follows the patch merge keys Kubernetes defines for
+// common list fields
+var DefaultMergeKeys = MergeKeys{
+	"containers":                {"name"},
+	"initContainers":            {"name"},
+	"ephemeralContainers":       {"name"},
+	"env":                       {"name"},
+	"volumes":                   {"name"},
+	"volumeMounts":              {"mountPath"},
+	"volumeDevices":             {"devicePath"},
+	"ports":                     {"containerPort", "port"},
+	"imagePullSecrets":          {"name"},
+	"hostAliases":               {"ip"},
+	"readinessGates":            {"conditionType"},
+	"resourceClaims":            {"name"},
+	"topologySpreadConstraints": {"topologyKey"},
+	"conditions":                {"type"},
+	"ownerReferences":           {"uid"},
+}
+
+// fallbackMergeKey is used for list fields without a table entry
+const fallbackMergeKey = "name"
+
+// lookup returns the candidate merge keys for the list at path
+func (k MergeKeys) lookup(path []pathSegment) []string {
+	var fields []string
+	for _, seg := range path {
+		if !seg.list {
+			fields = append(fields, seg.key)
+		}
+	}
+
+	if keys, ok := k[strings.Join(fields, ".")]; ok {
+		return keys
+	}
+	if len(fields) > 0 {
+		if keys, ok := k[fields[len(fields)-1]]; ok {
+			return keys
+		}
+	}
+	return []string{fallbackMergeKey}
+}
+
+// merge returns a new table with the entries of other added to k
+func (k MergeKeys) merge(other MergeKeys) MergeKeys {
+	result := make(MergeKeys, len(k)+len(other))
+	for field, keys := range k {
+		result[field] = keys
+	}
+	for field, keys := range other {
+		result[field] = keys
+	}
+	return result
+}
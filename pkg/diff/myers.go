@@ -0,0 +1,142 @@
+package diff
+
+// myers computes a minimal edit script between two sequences using the
+// linear-space variant of Myers' O(ND) algorithm. Sequences are compared
+// as integer symbols so that callers can diff lines, words or characters
+// with the same implementation.
+type myers struct {
+	a, b     []int
+	removed  []bool
+	inserted []bool
+	vf, vb   []int
+}
+
+// editScript returns, for every element of a and b, whether it was removed
+// from a or inserted into b. Elements not marked are common to both.
+func editScript(a, b []int) (removed, inserted []bool) {
+	m := &myers{
+		a:        a,
+		b:        b,
+		removed:  make([]bool, len(a)),
+		inserted: make([]bool, len(b)),
+	}
+	size := len(a) + len(b) + 3
+	m.vf = make([]int, 2*size)
+	m.vb = make([]int, 2*size)
+	m.compare(0, len(a), 0, len(b))
+	return m.removed, m.inserted
+}
+
+// compare marks the edits needed to turn a[aLo:aHi] into b[bLo:bHi]
+func (m *myers) compare(aLo, aHi, bLo, bHi int) {
+	// Common prefixes and suffixes never take part in an edit
+	for aLo < aHi && bLo < bHi && m.a[aLo] == m.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && m.a[aHi-1] == m.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for i := bLo; i < bHi; i++ {
+			m.inserted[i] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			m.removed[i] = true
+		}
+	default:
+		x, y, u, v := m.middleSnake(aLo, aHi, bLo, bHi)
+		m.compare(aLo, x, bLo, y)
+		m.compare(u, aHi, v, bHi)
+	}
+}
+
+// middleSnake finds the middle snake of an optimal path through the edit
+// graph of a[aLo:aHi] and b[bLo:bHi], returning its start and end points
+func (m *myers) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n := aHi - aLo
+	mm := bHi - bLo
+	delta := n - mm
+	odd := delta&1 != 0
+	maxD := (n + mm + 1) / 2
+	offset := maxD + 1
+
+	vf := m.vf[:2*offset+1]
+	vb := m.vb[:2*offset+1]
+	vf[offset+1] = 0
+	vb[offset+1] = 0
+
+	for d := 0; d <= maxD; d++ {
+		// Extend the forward paths
+		for k := -d; k <= d; k += 2 {
+			var px int
+			if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+				px = vf[offset+k+1]
+			} else {
+				px = vf[offset+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < mm && m.a[aLo+px] == m.b[bLo+py] {
+				px++
+				py++
+			}
+			vf[offset+k] = px
+
+			if odd {
+				// The reverse diagonal matching forward diagonal k
+				rk := delta - k
+				if rk >= -(d-1) && rk <= d-1 && px+vb[offset+rk] >= n {
+					return aLo + sx, bLo + sy, aLo + px, bLo + py
+				}
+			}
+		}
+
+		// Extend the reverse paths, measured from the end of both sequences
+		for k := -d; k <= d; k += 2 {
+			var px int
+			if k == -d || (k != d && vb[offset+k-1] < vb[offset+k+1]) {
+				px = vb[offset+k+1]
+			} else {
+				px = vb[offset+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < mm && m.a[aHi-1-px] == m.b[bHi-1-py] {
+				px++
+				py++
+			}
+			vb[offset+k] = px
+
+			if !odd {
+				fk := delta - k
+				if fk >= -d && fk <= d && vf[offset+fk]+px >= n {
+					return aHi - px, bHi - py, aHi - sx, bHi - sy
+				}
+			}
+		}
+	}
+
+	// Unreachable for well-formed input: a path of length n+m always exists
+	return aLo, bLo, aHi, bHi
+}
+
+// symbolTable interns strings as integers for use with editScript
+type symbolTable map[string]int
+
+func (t symbolTable) symbols(items []string) []int {
+	ids := make([]int, len(items))
+	for i, item := range items {
+		id, ok := t[item]
+		if !ok {
+			id = len(t)
+			t[item] = id
+		}
+		ids[i] = id
+	}
+	return ids
+}
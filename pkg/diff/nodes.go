@@ -0,0 +1,85 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// walkNode visits every mapping value and sequence element below node in
+// document order, passing the path of the entry as used by FieldChange.
+// When visit returns true the entry is removed from its parent and not
+// descended into; visit may otherwise modify the node in place.
+func walkNode(node *yaml.Node, path []pathSegment, mergeKeys MergeKeys, visit func([]pathSegment, *yaml.Node) bool) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkNode(child, path, mergeKeys, visit)
+		}
+
+	case yaml.MappingNode:
+		kept := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := appendSegment(path, pathSegment{key: key.Value})
+			if visit(childPath, value) {
+				continue
+			}
+			walkNode(value, childPath, mergeKeys, visit)
+			kept = append(kept, key, value)
+		}
+		node.Content = kept
+
+	case yaml.SequenceNode:
+		field, keys := sequenceKeys(node, path, mergeKeys)
+		kept := node.Content[:0]
+		for i, elem := range node.Content {
+			var key string
+			if field != "" {
+				key = keys[i]
+			}
+			childPath := appendSegment(path, listSegment(field, key, i))
+			if visit(childPath, elem) {
+				continue
+			}
+			walkNode(elem, childPath, mergeKeys, visit)
+			kept = append(kept, elem)
+		}
+		node.Content = kept
+	}
+}
+
+// sequenceKeys returns the merge key field of the elements of a sequence
+// and their values for it, as the structural comparison matches them, or
+// an empty field when the elements are identified by their index
+func sequenceKeys(node *yaml.Node, path []pathSegment, mergeKeys MergeKeys) (string, []string) {
+	var elements []interface{}
+	if err := node.Decode(&elements); err == nil {
+		elements = normalizeValue(elements).([]interface{})
+		for _, field := range mergeKeys.lookup(path) {
+			if keys, ok := elementKeys(elements, field); ok && len(keys) == len(node.Content) {
+				return field, keys
+			}
+		}
+	}
+	return "", nil
+}
+
+// encodeNode renders a YAML node as text with two-space indentation
+func encodeNode(node *yaml.Node) (string, error) {
+	if node == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
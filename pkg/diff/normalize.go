@@ -0,0 +1,228 @@
+package diff
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Normalizer rewrites a manifest before it is compared so that differences
+// without meaning, such as key order or quoting, are not reported. node is
+// the root of the document, usually a mapping, and is modified in place.
+// Normalize reports whether it changed anything.
+type Normalizer interface {
+	Normalize(id ResourceID, node *yaml.Node) bool
+}
+
+// NormalizerFunc adapts a function to the Normalizer interface
+type NormalizerFunc func(id ResourceID, node *yaml.Node) bool
+
+func (f NormalizerFunc) Normalize(id ResourceID, node *yaml.Node) bool {
+	return f(id, node)
+}
+
+var (
+	// SortKeys orders mapping keys alphabetically, so that the line diff
+	// of reordered keys is empty
+	SortKeys Normalizer = NormalizerFunc(sortKeys)
+
+	// CanonicalizeScalars writes scalars in a single form: quoted strings
+	// that read as a number or boolean, such as "80", become that number
+	// or boolean, numbers are written in decimal and whole floats such as
+	// 1.0 become integers, and strings lose redundant quotes
+	CanonicalizeScalars Normalizer = NormalizerFunc(canonicalizeScalars)
+
+	// DropEmpty removes mapping entries that are null, empty mappings or
+	// empty lists, as the API server treats them as unset
+	DropEmpty Normalizer = NormalizerFunc(dropEmpty)
+
+	// KubernetesDefaults fills in a selection of the defaults the API
+	// server applies to pods, workloads and services, such as protocol:
+	// TCP on ports and the imagePullPolicy derived from the image tag, so
+	// that setting a field to its default is not reported as a change
+	KubernetesDefaults Normalizer = NormalizerFunc(applyKubernetesDefaults)
+)
+
+// DefaultNormalizers is the normalization pipeline for reporting only
+// semantically meaningful differences. KubernetesDefaults is not included
+// since it hides differences from the manifests as rendered; add it before
+// these to also apply the defaults.
+var DefaultNormalizers = []Normalizer{CanonicalizeScalars, DropEmpty, SortKeys}
+
+// normalize applies the configured normalizers to a manifest, reporting
+// whether any of them changed it
+func (d *Diff) normalize(m *manifest) bool {
+	if len(d.normalizers) == 0 || m.node == nil || len(m.node.Content) == 0 {
+		return false
+	}
+	changed := false
+	for _, n := range d.normalizers {
+		if n.Normalize(m.id, m.node.Content[0]) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func sortKeys(_ ResourceID, node *yaml.Node) bool {
+	changed := false
+	switch node.Kind {
+	case yaml.MappingNode:
+		pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+		}
+		sorted := sort.SliceIsSorted(pairs, func(a, b int) bool {
+			return pairs[a][0].Value < pairs[b][0].Value
+		})
+		if !sorted {
+			sort.SliceStable(pairs, func(a, b int) bool {
+				return pairs[a][0].Value < pairs[b][0].Value
+			})
+			for i, pair := range pairs {
+				node.Content[2*i], node.Content[2*i+1] = pair[0], pair[1]
+			}
+			changed = true
+		}
+		for _, pair := range pairs {
+			if sortKeys(ResourceID{}, pair[1]) {
+				changed = true
+			}
+		}
+	case yaml.SequenceNode:
+		for _, elem := range node.Content {
+			if sortKeys(ResourceID{}, elem) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func canonicalizeScalars(_ ResourceID, node *yaml.Node) bool {
+	if node.Kind != yaml.ScalarNode {
+		changed := false
+		for _, child := range node.Content {
+			if canonicalizeScalars(ResourceID{}, child) {
+				changed = true
+			}
+		}
+		return changed
+	}
+
+	switch tag := node.ShortTag(); tag {
+	case "!!str":
+		return canonicalizeString(node)
+	case "!!int", "!!float", "!!bool", "!!null":
+		value, ok := canonicalValue(tag, node.Value)
+		if !ok || (value == node.Value && node.Tag == "" && node.Style == 0) {
+			return false
+		}
+		node.Value, node.Tag, node.Style = value, "", 0
+		return true
+	default:
+		// Timestamps, binary data and custom tags are left alone
+		return false
+	}
+}
+
+// canonicalizeString removes the quotes of a string scalar, turning it
+// into a number or boolean when that is how it reads without quotes
+func canonicalizeString(node *yaml.Node) bool {
+	// Explicitly tagged strings such as !!str 80 are left alone
+	if node.Style == 0 || node.Style&yaml.TaggedStyle != 0 {
+		return false
+	}
+	switch tag := plainTag(node.Value); tag {
+	case "!!str":
+		node.Tag, node.Style = "", 0
+		return true
+	case "!!int", "!!float", "!!bool":
+		// Only canonical text is converted, so that "1.20" stays a string
+		// rather than becoming the number 1.2
+		if value, ok := canonicalValue(tag, node.Value); ok && value == node.Value {
+			node.Tag, node.Style = "", 0
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalValue returns the canonical text of a scalar of the given type,
+// writing whole floats as integers
+func canonicalValue(tag, value string) (string, bool) {
+	plain := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	switch tag {
+	case "!!int":
+		var i int64
+		if err := plain.Decode(&i); err != nil {
+			return "", false
+		}
+		return strconv.FormatInt(i, 10), true
+	case "!!float":
+		var f float64
+		if err := plain.Decode(&f); err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", false
+		}
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return strconv.FormatInt(int64(f), 10), true
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), true
+	case "!!bool":
+		var b bool
+		if err := plain.Decode(&b); err != nil {
+			return "", false
+		}
+		return strconv.FormatBool(b), true
+	case "!!null":
+		return "null", true
+	}
+	return "", false
+}
+
+// plainTag returns the type a scalar written without quotes resolves to
+func plainTag(value string) string {
+	return (&yaml.Node{Kind: yaml.ScalarNode, Value: value}).ShortTag()
+}
+
+func dropEmpty(_ ResourceID, node *yaml.Node) bool {
+	changed := false
+	switch node.Kind {
+	case yaml.MappingNode:
+		kept := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if dropEmpty(ResourceID{}, value) {
+				changed = true
+			}
+			if isEmptyNode(value) {
+				changed = true
+				continue
+			}
+			kept = append(kept, key, value)
+		}
+		node.Content = kept
+	case yaml.SequenceNode:
+		for _, elem := range node.Content {
+			if dropEmpty(ResourceID{}, elem) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// isEmptyNode reports whether node is null, an empty mapping or an empty
+// list
+func isEmptyNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(node.Content) == 0
+	case yaml.ScalarNode:
+		return node.ShortTag() == "!!null"
+	default:
+		return false
+	}
+}
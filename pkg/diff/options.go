@@ -0,0 +1,159 @@
+package diff
+
+import "fmt"
+
+// DefaultContextLines is the number of unchanged lines shown around each
+// change in unified diff output
+const DefaultContextLines = 3
+
+// Option configures a Diff
+type Option func(*Diff)
+
+// WithContextLines sets the number of unchanged lines shown around each
+// change. Negative values are treated as zero.
+func WithContextLines(n int) Option {
+	return func(d *Diff) {
+		if n < 0 {
+			n = 0
+		}
+		d.contextLines = n
+	}
+}
+
+// WithLabels sets the labels written in the "---" and "+++" file headers
+// of unified diff output, for example the release names being compared.
+// Without labels, single comparisons are written as bare hunks; resources
+// in multi-manifest comparisons are always labelled with their identity,
+// prefixed by these labels when set.
+func WithLabels(oldLabel, newLabel string) Option {
+	return func(d *Diff) {
+		d.oldLabel = oldLabel
+		d.newLabel = newLabel
+	}
+}
+
+// WithSemanticComparison compares manifests by their parsed YAML structure.
+// Differences in formatting, key order or quoting alone are then not
+// reported as differences, and manifests that fail to parse are an error.
+func WithSemanticComparison() Option {
+	return func(d *Diff) {
+		d.semantic = true
+	}
+}
+
+// WithIntraLineDiff refines every removed line paired with an added line
+// into word or character edits, available as the Segments of the hunk
+// lines, and likewise refines modified string values in structural
+// changes. The unified diff text itself is unchanged.
+func WithIntraLineDiff(granularity Granularity) Option {
+	return func(d *Diff) {
+		d.intraLine = granularity
+	}
+}
+
+// WithMergeKeys adds or overrides entries of the merge key table used to
+// match list elements in structural comparisons, typically for the list
+// fields of custom resources
+func WithMergeKeys(keys MergeKeys) Option {
+	return func(d *Diff) {
+		d.mergeKeys = d.mergeKeys.merge(keys)
+	}
+}
+
+// WithRenameThreshold sets the minimum similarity, between 0 and 1, at
+// which a removed and an added resource of the same kind are reported as
+// one renamed resource. Similarity is the share of lines the two documents
+// have in common; the default is DefaultRenameThreshold.
+func WithRenameThreshold(threshold float64) Option {
+	return func(d *Diff) {
+		if threshold <= 0 || threshold > 1 {
+			d.err = fmt.Errorf("invalid rename threshold %v: must be greater than 0 and at most 1", threshold)
+			return
+		}
+		d.renameThreshold = threshold
+	}
+}
+
+// WithoutRenameDetection reports every resource whose identity changed as
+// removed and added
+func WithoutRenameDetection() Option {
+	return func(d *Diff) {
+		d.renameThreshold = 0
+	}
+}
+
+// WithIgnoreRules removes the fields selected by rules from both sides
+// before comparing manifests, for example checksum annotations or chart
+// version labels that change on every render. Rules can be loaded from a
+// file with LoadIgnoreRules.
+func WithIgnoreRules(rules ...FieldRule) Option {
+	return func(d *Diff) {
+		selectors, err := compileRules(rules)
+		if err != nil {
+			d.err = fmt.Errorf("invalid ignore rules: %w", err)
+			return
+		}
+		d.ignore = append(d.ignore, selectors...)
+	}
+}
+
+// WithMaskRules redacts the values selected by rules in addition to the
+// values of Secret resources, for example credentials embedded in custom
+// resources. Redacted values are shown as a marker carrying a hash, so a
+// changed value is still reported without revealing it.
+func WithMaskRules(rules ...FieldRule) Option {
+	return func(d *Diff) {
+		selectors, err := compileRules(rules)
+		if err != nil {
+			d.err = fmt.Errorf("invalid mask rules: %w", err)
+			return
+		}
+		d.mask = append(d.mask, selectors...)
+	}
+}
+
+// WithoutSecretMasking disables the default redaction of Secret values.
+// Rules added with WithMaskRules still apply.
+//
+// Manifests that are not valid YAML cannot be redacted. They are still
+// compared as text unless they could hold masked values: when they name a
+// kind covered by a mask rule, such as kind: Secret or kind: SecretList,
+// or a mask rule covers every kind, comparing them is an error instead.
+func WithoutSecretMasking() Option {
+	return func(d *Diff) {
+		d.maskSecrets = false
+	}
+}
+
+// WithEmbeddedDocuments compares the string values selected by rules as
+// embedded documents, in addition to the values of ConfigMap data. The
+// format of a document is detected from the extension of its key, such as
+// config.json or app.properties, or else from its content.
+func WithEmbeddedDocuments(rules ...FieldRule) Option {
+	return func(d *Diff) {
+		selectors, err := compileRules(rules)
+		if err != nil {
+			d.err = fmt.Errorf("invalid embedded document rules: %w", err)
+			return
+		}
+		d.embedded = append(d.embedded, selectors...)
+	}
+}
+
+// WithoutEmbeddedDocuments compares all string values as plain scalars,
+// including those selected with WithEmbeddedDocuments
+func WithoutEmbeddedDocuments() Option {
+	return func(d *Diff) {
+		d.embedDocuments = false
+	}
+}
+
+// WithNormalizers rewrites both manifests with the given normalizers before
+// they are compared, for example WithNormalizers(DefaultNormalizers...).
+// Normalizers run in the order given, before ignore and mask rules; put
+// KubernetesDefaults before SortKeys so that filled in keys are sorted.
+func WithNormalizers(normalizers ...Normalizer) Option {
+	return func(d *Diff) {
+		d.normalizers = append(d.normalizers, normalizers...)
+	}
+}
@@ -0,0 +1,179 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pathPattern matches field paths in the notation used by FieldChange,
+// extended with glob wildcards:
+//
+//	metadata.annotations["checksum/*"]    quoted mapping key, glob allowed
+//	metadata.labels.app*                  dotted mapping key, glob allowed
+//	spec.containers[*].image              any list element
+//	spec.containers[name=web].image       list element by merge key
+//	spec.containers[web].image            list element by merge key or index
+//	**.imagePullPolicy                    any number of segments
+//
+// A leading "$" or "$." as used by JSONPath is accepted and ignored. The
+// JSONPath recursive descent ".." is rejected; use "**" instead.
+type pathPattern struct {
+	source   string
+	segments []patternSegment
+}
+
+type patternSegment struct {
+	glob     *regexp.Regexp
+	list     bool
+	anyDepth bool
+	// field is the merge key named by a [field=value] selector
+	field string
+}
+
+// parsePathPattern parses a path pattern
+func parsePathPattern(s string) (pathPattern, error) {
+	p := pathPattern{source: s}
+	rest := strings.TrimPrefix(s, "$")
+	if strings.HasPrefix(rest, "..") {
+		return p, fmt.Errorf("invalid path pattern %q: recursive descent \"..\" is not supported, use \"**\"", s)
+	}
+	rest = strings.TrimPrefix(rest, ".")
+	if rest == "" {
+		return p, fmt.Errorf("invalid path pattern %q: empty path", s)
+	}
+
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end, key, quoted, err := parseBracket(rest)
+			if err != nil {
+				return p, fmt.Errorf("invalid path pattern %q: %w", s, err)
+			}
+			seg := patternSegment{list: !quoted}
+			if field, value, ok := strings.Cut(key, "="); ok && !quoted {
+				seg.field, key = field, value
+			}
+			seg.glob = compileGlob(key)
+			p.segments = append(p.segments, seg)
+			rest = rest[end:]
+		case rest[0] == '.':
+			rest = rest[1:]
+			if rest == "" {
+				return p, fmt.Errorf("invalid path pattern %q: empty segment", s)
+			}
+			if rest[0] == '.' {
+				return p, fmt.Errorf("invalid path pattern %q: recursive descent \"..\" is not supported, use \"**\"", s)
+			}
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "**" {
+				p.segments = append(p.segments, patternSegment{anyDepth: true})
+			} else {
+				p.segments = append(p.segments, patternSegment{glob: compileGlob(key)})
+			}
+			rest = rest[end:]
+		}
+	}
+
+	return p, nil
+}
+
+// parseBracket parses a leading [..] selector, returning the length
+// consumed, the selector content and whether it was quoted
+func parseBracket(s string) (int, string, bool, error) {
+	if len(s) > 1 && (s[1] == '"' || s[1] == '\'') {
+		quote := s[1]
+		var sb strings.Builder
+		for i := 2; i < len(s); i++ {
+			switch {
+			case s[i] == '\\' && i+1 < len(s):
+				i++
+				sb.WriteByte(s[i])
+			case s[i] == quote:
+				if i+1 >= len(s) || s[i+1] != ']' {
+					return 0, "", false, fmt.Errorf("expected ] after quoted key")
+				}
+				return i + 2, sb.String(), true, nil
+			default:
+				sb.WriteByte(s[i])
+			}
+		}
+		return 0, "", false, fmt.Errorf("unterminated quoted key")
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return 0, "", false, fmt.Errorf("unterminated [")
+	}
+	if end == 1 {
+		return 0, "", false, fmt.Errorf("empty []")
+	}
+	return end + 1, s[1:end], false, nil
+}
+
+// compileGlob converts a glob where * matches any run of characters and ?
+// matches a single character into an anchored regular expression
+func compileGlob(glob string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// match reports whether the pattern matches path exactly
+func (p pathPattern) match(path []pathSegment) bool {
+	return matchSegments(p.segments, path)
+}
+
+func matchSegments(pattern []patternSegment, path []pathSegment) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	head := pattern[0]
+	if head.anyDepth {
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 || head.list != path[0].list || !head.matchKey(path[0]) {
+		return false
+	}
+	return matchSegments(pattern[1:], path[1:])
+}
+
+// matchKey reports whether the segment selects seg. A list element
+// identified by merge key matches by its key or by its index, unless the
+// segment names the merge key field.
+func (s patternSegment) matchKey(seg pathSegment) bool {
+	if s.field != "" {
+		return s.field == seg.field && s.glob.MatchString(seg.key)
+	}
+	if s.glob.MatchString(seg.key) {
+		return true
+	}
+	return seg.index != "" && s.glob.MatchString(seg.index)
+}
+
+func (p pathPattern) String() string {
+	return p.source
+}
@@ -0,0 +1,281 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity ranks how much a change matters to a policy
+type Severity int
+
+const (
+	// SeverityNone marks changes the policy ignores
+	SeverityNone Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"none", "info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < SeverityNone || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses a severity name: none, info, warning or error
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(name, n) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityNone, fmt.Errorf("unknown severity %q", name)
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	parsed, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// PolicyRule assigns a severity to the changes it matches. Kind, Namespace
+// and Name are globs matched against the resource identity as in
+// FieldRule, Changes restricts the rule to resources that were added,
+// removed, modified or renamed, and Paths restricts it to changes at or
+// below the given path patterns. Empty fields match everything, so a rule
+// without paths also matches the addition or removal of a whole resource.
+type PolicyRule struct {
+	Severity  Severity     `yaml:"severity"`
+	Kind      string       `yaml:"kind,omitempty"`
+	Namespace string       `yaml:"namespace,omitempty"`
+	Name      string       `yaml:"name,omitempty"`
+	Changes   []ChangeType `yaml:"changes,omitempty"`
+	Paths     []string     `yaml:"paths,omitempty"`
+}
+
+// Policy classifies the changes of a comparison by severity, for example to
+// gate CI on changes to images or removed resources while ignoring label
+// churn. Every change takes the severity of the first rule that matches
+// it, or Default when none does. ExitCodes maps severities to process exit
+// codes, overriding DefaultExitCodes.
+type Policy struct {
+	Default   Severity         `yaml:"default,omitempty"`
+	ExitCodes map[Severity]int `yaml:"exitCodes,omitempty"`
+	Rules     []PolicyRule     `yaml:"rules"`
+}
+
+// DefaultExitCodes fails only on changes of error severity
+var DefaultExitCodes = map[Severity]int{
+	SeverityNone:    0,
+	SeverityInfo:    0,
+	SeverityWarning: 0,
+	SeverityError:   1,
+}
+
+// LoadPolicy reads a policy from a YAML file of the form
+//
+//	default: info
+//	exitCodes:
+//	  warning: 0
+//	  error: 3
+//	rules:
+//	  - severity: none
+//	    paths: ["metadata.labels", "**.metadata.labels"]
+//	  - severity: error
+//	    kind: Deployment
+//	    paths: ["spec.template.spec.containers[*].image"]
+//	  - severity: error
+//	    changes: [removed]
+//	  - severity: error
+//	    namespace: kube-system
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy %s: %w", filename, err)
+	}
+
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", filename, err)
+	}
+	if _, err := policy.compile(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", filename, err)
+	}
+
+	return &policy, nil
+}
+
+// PolicyViolation is a change classified by a policy
+type PolicyViolation struct {
+	Resource ResourceID
+	// ResourceChange is how the resource containing the change changed
+	ResourceChange ChangeType
+	Change         FieldChange
+	Severity       Severity
+	// Rule is the index of the rule that matched, or -1 when the change
+	// took the default severity
+	Rule int
+}
+
+// String formats the violation as "severity resource: change"
+func (v PolicyViolation) String() string {
+	if v.Resource == (ResourceID{}) {
+		return fmt.Sprintf("%s %s", v.Severity, v.Change)
+	}
+	return fmt.Sprintf("%s %s: %s", v.Severity, v.Resource, v.Change)
+}
+
+// PolicyResult is the result of applying a policy to a comparison
+type PolicyResult struct {
+	// Violations holds the changes of a severity other than none, in the
+	// order of the comparison
+	Violations []PolicyViolation
+	// Severity is the highest severity of any change
+	Severity Severity
+	exitCode int
+}
+
+// ExitCode returns the process exit code for the highest severity
+func (r *PolicyResult) ExitCode() int {
+	return r.exitCode
+}
+
+// String returns the violations one per line
+func (r *PolicyResult) String() string {
+	lines := make([]string, len(r.Violations))
+	for i, v := range r.Violations {
+		lines[i] = v.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ExitCode returns the process exit code for a severity
+func (p *Policy) ExitCode(s Severity) int {
+	if code, ok := p.ExitCodes[s]; ok {
+		return code
+	}
+	return DefaultExitCodes[s]
+}
+
+// Classify assigns a severity to every change of a comparison. Rules that
+// select resources apply to multi-manifest comparisons; the changes of a
+// single manifest comparison have no resource identity.
+func (p *Policy) Classify(result *DiffResult) (*PolicyResult, error) {
+	rules, err := p.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	classified := &PolicyResult{}
+	classify := func(id ResourceID, change ChangeType, fc FieldChange) {
+		v := PolicyViolation{Resource: id, ResourceChange: change, Change: fc, Severity: p.Default, Rule: -1}
+		for i, rule := range rules {
+			if rule.matches(id, change, fc.segments) {
+				v.Severity, v.Rule = rule.severity, i
+				break
+			}
+		}
+		if v.Severity == SeverityNone {
+			return
+		}
+		classified.Violations = append(classified.Violations, v)
+		if v.Severity > classified.Severity {
+			classified.Severity = v.Severity
+		}
+	}
+
+	for _, fc := range result.changes {
+		classify(ResourceID{}, Modified, fc)
+	}
+	for _, res := range result.resources {
+		for _, fc := range res.Result.changes {
+			classify(res.ID, res.Change, fc)
+		}
+	}
+
+	classified.exitCode = p.ExitCode(classified.Severity)
+	return classified, nil
+}
+
+// policyRule is the compiled form of a PolicyRule
+type policyRule struct {
+	severity Severity
+	selector fieldSelector
+	changes  []ChangeType
+}
+
+// compile parses the globs and path patterns of the rules
+func (p *Policy) compile() ([]policyRule, error) {
+	if p.Default < SeverityNone || p.Default > SeverityError {
+		return nil, fmt.Errorf("invalid default severity %d", p.Default)
+	}
+	rules := make([]policyRule, 0, len(p.Rules))
+	for i, rule := range p.Rules {
+		if rule.Severity < SeverityNone || rule.Severity > SeverityError {
+			return nil, fmt.Errorf("rule %d: invalid severity %d", i+1, rule.Severity)
+		}
+		for _, c := range rule.Changes {
+			switch c {
+			case Added, Removed, Modified, Renamed:
+			default:
+				return nil, fmt.Errorf("rule %d: invalid change %q", i+1, c)
+			}
+		}
+		sel := fieldSelector{
+			kind:      optionalGlob(rule.Kind),
+			namespace: optionalGlob(rule.Namespace),
+			name:      optionalGlob(rule.Name),
+		}
+		for _, path := range rule.Paths {
+			pattern, err := parsePathPattern(path)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			sel.patterns = append(sel.patterns, pattern)
+		}
+		rules = append(rules, policyRule{severity: rule.Severity, selector: sel, changes: rule.Changes})
+	}
+	return rules, nil
+}
+
+// matches reports whether the rule covers a change at path of a resource
+// that changed as given. A path pattern covers the subtree below it.
+func (r policyRule) matches(id ResourceID, change ChangeType, path []pathSegment) bool {
+	if !r.selector.appliesTo(id) {
+		return false
+	}
+	if len(r.changes) > 0 && !containsChange(r.changes, change) {
+		return false
+	}
+	if len(r.selector.patterns) == 0 {
+		return true
+	}
+	for i := 1; i <= len(path); i++ {
+		if r.selector.matches(path[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsChange(changes []ChangeType, change ChangeType) bool {
+	for _, c := range changes {
+		if c == change {
+			return true
+		}
+	}
+	return false
+}
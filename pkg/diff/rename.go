@@ -0,0 +1,100 @@
+package diff
+
+import "sort"
+
+// DefaultRenameThreshold is the minimum similarity at which a removed and
+// an added resource of the same kind are reported as a rename
+const DefaultRenameThreshold = 0.7
+
+// renameCandidate is a possible pairing of an unmatched old document with
+// an unmatched new document
+type renameCandidate struct {
+	old, new   int
+	similarity float64
+}
+
+// detectRenames pairs old and new documents that were not matched by
+// identity, have the same kind and are at least as similar as the rename
+// threshold. The most similar pairs are taken first. Pairs are recorded in
+// pairs and matched like identity matches, and the similarity of every
+// rename is returned keyed by the index of the old document.
+func (d *Diff) detectRenames(oldDocs, newDocs []manifest, pairs []int, matched []bool) (map[int]float64, error) {
+	if d.renameThreshold <= 0 {
+		return nil, nil
+	}
+
+	oldLines := make(map[int][]string)
+	for i, doc := range oldDocs {
+		if pairs[i] >= 0 || doc.id.Kind == "" {
+			continue
+		}
+		text, err := encodeNode(doc.node)
+		if err != nil {
+			return nil, err
+		}
+		oldLines[i], _ = splitLines(text)
+	}
+	if len(oldLines) == 0 {
+		return nil, nil
+	}
+
+	var candidates []renameCandidate
+	for j, doc := range newDocs {
+		if matched[j] || doc.id.Kind == "" {
+			continue
+		}
+		text, err := encodeNode(doc.node)
+		if err != nil {
+			return nil, err
+		}
+		newLines, _ := splitLines(text)
+		for i, lines := range oldLines {
+			if oldDocs[i].id.Kind != doc.id.Kind {
+				continue
+			}
+			if similarity := lineSimilarity(lines, newLines); similarity >= d.renameThreshold {
+				candidates = append(candidates, renameCandidate{old: i, new: j, similarity: similarity})
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(a, b int) bool {
+		ca, cb := candidates[a], candidates[b]
+		if ca.similarity != cb.similarity {
+			return ca.similarity > cb.similarity
+		}
+		if ca.old != cb.old {
+			return ca.old < cb.old
+		}
+		return ca.new < cb.new
+	})
+
+	renames := make(map[int]float64)
+	for _, c := range candidates {
+		if pairs[c.old] >= 0 || matched[c.new] {
+			continue
+		}
+		pairs[c.old] = c.new
+		matched[c.new] = true
+		renames[c.old] = c.similarity
+	}
+	return renames, nil
+}
+
+// lineSimilarity returns twice the number of lines a and b have in common
+// divided by their total number of lines: 1 for identical documents and 0
+// for documents without a common line
+func lineSimilarity(a, b []string) float64 {
+	if len(a)+len(b) == 0 {
+		return 1
+	}
+	table := make(symbolTable)
+	removed, _ := editScript(table.symbols(a), table.symbols(b))
+	common := 0
+	for _, r := range removed {
+		if !r {
+			common++
+		}
+	}
+	return float64(2*common) / float64(len(a)+len(b))
+}
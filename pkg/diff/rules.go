@@ -0,0 +1,140 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldRule selects fields within the resources it applies to. Kind,
+// Namespace and Name are globs matched against the resource identity, and
+// an empty value matches every resource. Paths are path patterns such as
+// metadata.annotations["checksum/*"] or spec.template.spec.containers[*].env;
+// a matching path selects the whole subtree below it.
+type FieldRule struct {
+	Kind      string   `yaml:"kind,omitempty"`
+	Namespace string   `yaml:"namespace,omitempty"`
+	Name      string   `yaml:"name,omitempty"`
+	Paths     []string `yaml:"paths"`
+}
+
+// ignoreFile is the layout of a file read by LoadIgnoreRules
+type ignoreFile struct {
+	Ignore []FieldRule `yaml:"ignore"`
+}
+
+// LoadIgnoreRules reads ignore rules from a YAML file of the form
+//
+//	ignore:
+//	  - paths:
+//	      - metadata.annotations["checksum/*"]
+//	      - metadata.labels["helm.sh/chart"]
+//	  - kind: Secret
+//	    name: "*-generated"
+//	    paths: ["data.*"]
+func LoadIgnoreRules(filename string) ([]FieldRule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore rules %s: %w", filename, err)
+	}
+
+	var file ignoreFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse ignore rules %s: %w", filename, err)
+	}
+	if _, err := compileRules(file.Ignore); err != nil {
+		return nil, fmt.Errorf("invalid ignore rules %s: %w", filename, err)
+	}
+
+	return file.Ignore, nil
+}
+
+// fieldSelector is the compiled form of a FieldRule
+type fieldSelector struct {
+	kind      *regexp.Regexp
+	namespace *regexp.Regexp
+	name      *regexp.Regexp
+	patterns  []pathPattern
+}
+
+// compileRules parses the globs and path patterns of rules
+func compileRules(rules []FieldRule) ([]fieldSelector, error) {
+	selectors := make([]fieldSelector, 0, len(rules))
+	for i, rule := range rules {
+		if len(rule.Paths) == 0 {
+			return nil, fmt.Errorf("rule %d: no paths", i+1)
+		}
+		sel := fieldSelector{
+			kind:      optionalGlob(rule.Kind),
+			namespace: optionalGlob(rule.Namespace),
+			name:      optionalGlob(rule.Name),
+		}
+		for _, p := range rule.Paths {
+			pattern, err := parsePathPattern(p)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			sel.patterns = append(sel.patterns, pattern)
+		}
+		selectors = append(selectors, sel)
+	}
+	return selectors, nil
+}
+
+func optionalGlob(glob string) *regexp.Regexp {
+	if glob == "" {
+		return nil
+	}
+	return compileGlob(glob)
+}
+
+// appliesTo reports whether the selector covers the resource
+func (s fieldSelector) appliesTo(id ResourceID) bool {
+	return (s.kind == nil || s.kind.MatchString(id.Kind)) &&
+		(s.namespace == nil || s.namespace.MatchString(id.Namespace)) &&
+		(s.name == nil || s.name.MatchString(id.Name))
+}
+
+// matches reports whether any path pattern of the selector matches path
+func (s fieldSelector) matches(path []pathSegment) bool {
+	for _, p := range s.patterns {
+		if p.match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// applicableSelectors returns the selectors that cover the resource
+func applicableSelectors(selectors []fieldSelector, id ResourceID) []fieldSelector {
+	var result []fieldSelector
+	for _, sel := range selectors {
+		if sel.appliesTo(id) {
+			result = append(result, sel)
+		}
+	}
+	return result
+}
+
+// removeIgnoredFields deletes the fields selected by the ignore rules from
+// the manifest, reporting whether anything was removed
+func (d *Diff) removeIgnoredFields(m *manifest) bool {
+	selectors := applicableSelectors(d.ignore, m.id)
+	if len(selectors) == 0 {
+		return false
+	}
+
+	removed := false
+	walkNode(m.node, nil, d.mergeKeys, func(path []pathSegment, _ *yaml.Node) bool {
+		for _, sel := range selectors {
+			if sel.matches(path) {
+				removed = true
+				return true
+			}
+		}
+		return false
+	})
+	return removed
+}
@@ -0,0 +1,42 @@
+package diff
+
+// sideBySideRow is one row of a side-by-side rendering of a hunk. Either
+// side is nil when the row only has a line on the other side.
+type sideBySideRow struct {
+	old *Line
+	new *Line
+}
+
+// sideBySideRows aligns the lines of a hunk for side-by-side display.
+// Context lines appear on both sides; within a change, removed lines are
+// paired with added lines in order and the remainder is left unpaired.
+func sideBySideRows(h Hunk) []sideBySideRow {
+	var rows []sideBySideRow
+	lines := h.Lines
+	for i := 0; i < len(lines); {
+		if lines[i].Op == ' ' {
+			rows = append(rows, sideBySideRow{old: &lines[i], new: &lines[i]})
+			i++
+			continue
+		}
+
+		var removed, added []*Line
+		for ; i < len(lines) && lines[i].Op == '-'; i++ {
+			removed = append(removed, &lines[i])
+		}
+		for ; i < len(lines) && lines[i].Op == '+'; i++ {
+			added = append(added, &lines[i])
+		}
+		for k := 0; k < max(len(removed), len(added)); k++ {
+			var row sideBySideRow
+			if k < len(removed) {
+				row.old = removed[k]
+			}
+			if k < len(added) {
+				row.new = added[k]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
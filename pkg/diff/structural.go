@@ -0,0 +1,411 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldChange describes a difference at a single path within a YAML
+// document, such as spec.template.spec.containers[name=web].image
+type FieldChange struct {
+	Path     string
+	Change   ChangeType
+	OldValue interface{}
+	NewValue interface{}
+	// Masked is set when the values were redacted; they then hold
+	// redaction markers rather than the original values
+	Masked bool
+	// Segments holds the word or character edits of a modified string
+	// value when intra-line refinement is enabled
+	Segments []Segment
+	// Embedded is the format of the embedded document the path descends
+	// into, such as the JSON file held by a ConfigMap key. Changes to
+	// embedded text that has no structure carry a line diff in Hunks.
+	Embedded EmbeddedFormat
+	Hunks    []Hunk
+
+	segments []pathSegment
+}
+
+// String formats the change as "path: old -> new", marking additions and
+// removals of whole subtrees. Refined string values are written as a word
+// diff, with long unchanged text around the edits elided, and embedded text
+// as an indented line diff on the lines following the path.
+func (c FieldChange) String() string {
+	return c.displayPath() + ": " + c.describe()
+}
+
+// describe formats the change without its path
+func (c FieldChange) describe() string {
+	if c.Masked {
+		return fmt.Sprintf("(%s) <redacted>", c.Change)
+	}
+	if c.Hunks != nil {
+		return fmt.Sprintf("(%s)\n%s", c.Change, indent(formatUnifiedDiff(c.Hunks, "", ""), "  "))
+	}
+	if c.Segments != nil {
+		return formatSegments(c.Segments, true)
+	}
+	switch c.Change {
+	case Added:
+		return "(added) " + formatValue(c.NewValue)
+	case Removed:
+		return "(removed) " + formatValue(c.OldValue)
+	default:
+		return formatValue(c.OldValue) + " -> " + formatValue(c.NewValue)
+	}
+}
+
+func (c FieldChange) displayPath() string {
+	if c.Path == "" {
+		return "."
+	}
+	return c.Path
+}
+
+// pathSegment is one step of a path: a mapping key or a list element,
+// identified by its index or its merge key value
+type pathSegment struct {
+	key  string
+	list bool
+	// field is the merge key of a list element identified by the value of
+	// that field, which key holds, and index its position, so that path
+	// patterns can select it by key or by index. Both are empty for list
+	// elements identified by their index.
+	field string
+	index string
+}
+
+// listSegment returns the path segment of the list element at index i,
+// identified by key, the value of its merge key field, or by its index
+// when field is empty
+func listSegment(field, key string, i int) pathSegment {
+	index := strconv.Itoa(i)
+	if field == "" {
+		return pathSegment{key: index, list: true}
+	}
+	return pathSegment{key: key, list: true, field: field, index: index}
+}
+
+// formatPath renders segments as a dotted path. Mapping keys that would be
+// ambiguous in dotted form are quoted, as in metadata.labels["helm.sh/chart"],
+// and list elements identified by merge key name the field, as in
+// spec.containers[name=web], to tell them apart from indexes.
+func formatPath(segments []pathSegment) string {
+	var sb strings.Builder
+	for i, seg := range segments {
+		switch {
+		case seg.list && seg.field != "":
+			sb.WriteString("[" + seg.field + "=" + seg.key + "]")
+		case seg.list:
+			sb.WriteString("[" + seg.key + "]")
+		case seg.key == "" || strings.ContainsAny(seg.key, ".[]\"' "):
+			sb.WriteString("[" + strconv.Quote(seg.key) + "]")
+		default:
+			if i > 0 {
+				sb.WriteString(".")
+			}
+			sb.WriteString(seg.key)
+		}
+	}
+	return sb.String()
+}
+
+// structuralWalker accumulates the changes between two decoded documents
+type structuralWalker struct {
+	d *Diff
+	// embedded selects the string values compared as embedded documents
+	embedded []fieldSelector
+	changes  []FieldChange
+}
+
+// compareValues walks two decoded YAML documents of the resource id and
+// returns the changes between them, ordered by path
+func (d *Diff) compareValues(id ResourceID, old, new interface{}) []FieldChange {
+	w := &structuralWalker{d: d}
+	if d.embedDocuments {
+		w.embedded = applicableSelectors(d.embedded, id)
+	}
+	w.walk(nil, normalizeValue(old), normalizeValue(new))
+	return w.changes
+}
+
+func (w *structuralWalker) record(path []pathSegment, change ChangeType, old, new interface{}) {
+	c := newFieldChange(path, change, old, new)
+	if oldText, ok := old.(string); ok && w.d.intraLine != LineGranularity && !c.Masked {
+		if newText, ok := new.(string); ok {
+			c.Segments = refine(oldText, newText, w.d.intraLine)
+		}
+	}
+	w.changes = append(w.changes, c)
+}
+
+func (w *structuralWalker) walk(path []pathSegment, old, new interface{}) {
+	switch {
+	case old == nil && new == nil:
+		return
+	case old == nil:
+		w.record(path, Added, nil, new)
+		return
+	case new == nil:
+		w.record(path, Removed, old, nil)
+		return
+	}
+
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if n, ok := new.(map[string]interface{}); ok {
+			w.walkMaps(path, o, n)
+			return
+		}
+	case []interface{}:
+		if n, ok := new.([]interface{}); ok {
+			w.walkLists(path, o, n)
+			return
+		}
+	case string:
+		if n, ok := new.(string); ok && o != n && w.isEmbedded(path, o, n) {
+			w.walkEmbedded(path, o, n)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		w.record(path, Modified, old, new)
+	}
+}
+
+func (w *structuralWalker) walkMaps(path []pathSegment, old, new map[string]interface{}) {
+	keys := make([]string, 0, len(old)+len(new))
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		childPath := appendSegment(path, pathSegment{key: k})
+		oldValue, inOld := old[k]
+		newValue, inNew := new[k]
+		switch {
+		case !inOld:
+			w.record(childPath, Added, nil, newValue)
+		case !inNew:
+			w.record(childPath, Removed, oldValue, nil)
+		case oldValue == nil || newValue == nil:
+			// An explicit null is a value of its own, not a missing key
+			if !reflect.DeepEqual(oldValue, newValue) {
+				w.record(childPath, Modified, oldValue, newValue)
+			}
+		default:
+			w.walk(childPath, oldValue, newValue)
+		}
+	}
+}
+
+// walkLists matches list elements by the merge key configured for the
+// list, so that inserting or reordering elements only reports the elements
+// that actually changed. Lists without a usable merge key are aligned by
+// a minimal edit script over their elements.
+func (w *structuralWalker) walkLists(path []pathSegment, old, new []interface{}) {
+	for _, field := range w.d.mergeKeys.lookup(path) {
+		oldKeys, oldKeyed := elementKeys(old, field)
+		newKeys, newKeyed := elementKeys(new, field)
+		if oldKeyed && newKeyed {
+			w.walkKeyedLists(path, old, new, field, oldKeys, newKeys)
+			return
+		}
+	}
+	w.walkIndexedLists(path, old, new)
+}
+
+func (w *structuralWalker) walkKeyedLists(path []pathSegment, old, new []interface{}, field string, oldKeys, newKeys []string) {
+	newIndex := make(map[string]int, len(newKeys))
+	for i, k := range newKeys {
+		newIndex[k] = i
+	}
+	oldIndex := make(map[string]int, len(oldKeys))
+	for i, k := range oldKeys {
+		oldIndex[k] = i
+	}
+
+	for i, k := range oldKeys {
+		if j, ok := newIndex[k]; ok {
+			w.walk(appendSegment(path, listSegment(field, k, j)), old[i], new[j])
+		} else {
+			w.record(appendSegment(path, listSegment(field, k, i)), Removed, old[i], nil)
+		}
+	}
+	for j, k := range newKeys {
+		if _, ok := oldIndex[k]; !ok {
+			w.record(appendSegment(path, listSegment(field, k, j)), Added, nil, new[j])
+		}
+	}
+}
+
+// walkIndexedLists aligns list elements with a minimal edit script over
+// their serialized form. Within a run of changes, removed and inserted
+// elements are paired up and compared field by field. Paths use the index
+// in the new list, or in the old list for removed elements.
+func (w *structuralWalker) walkIndexedLists(path []pathSegment, old, new []interface{}) {
+	table := make(symbolTable)
+	removed, inserted := editScript(table.symbols(serializeElements(old)), table.symbols(serializeElements(new)))
+
+	indexPath := func(i int) []pathSegment {
+		return appendSegment(path, listSegment("", "", i))
+	}
+
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		if (i < len(old) && removed[i]) || (j < len(new) && inserted[j]) {
+			var oldRun, newRun []int
+			for ; i < len(old) && removed[i]; i++ {
+				oldRun = append(oldRun, i)
+			}
+			for ; j < len(new) && inserted[j]; j++ {
+				newRun = append(newRun, j)
+			}
+
+			paired := min(len(oldRun), len(newRun))
+			for k := 0; k < paired; k++ {
+				w.walk(indexPath(newRun[k]), old[oldRun[k]], new[newRun[k]])
+			}
+			for _, oi := range oldRun[paired:] {
+				w.record(indexPath(oi), Removed, old[oi], nil)
+			}
+			for _, nj := range newRun[paired:] {
+				w.record(indexPath(nj), Added, nil, new[nj])
+			}
+			continue
+		}
+		i++
+		j++
+	}
+}
+
+// serializeElements renders list elements in a canonical form so that
+// equal elements compare equal regardless of mapping key order
+func serializeElements(list []interface{}) []string {
+	result := make([]string, len(list))
+	for i, elem := range list {
+		data, err := json.Marshal(elem)
+		if err != nil {
+			result[i] = fmt.Sprintf("%#v", elem)
+			continue
+		}
+		result[i] = string(data)
+	}
+	return result
+}
+
+// elementKeys returns the value of field for every list element, and
+// whether all elements are mappings with a distinct scalar value for it
+func elementKeys(list []interface{}, field string) ([]string, bool) {
+	if len(list) == 0 {
+		return nil, true
+	}
+
+	keys := make([]string, len(list))
+	seen := make(map[string]bool, len(list))
+	for i, elem := range list {
+		m, ok := elem.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		v, ok := m[field]
+		if !ok || v == nil {
+			return nil, false
+		}
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, false
+		}
+		k := fmt.Sprint(v)
+		if seen[k] {
+			return nil, false
+		}
+		seen[k] = true
+		keys[i] = k
+	}
+	return keys, true
+}
+
+func newFieldChange(path []pathSegment, change ChangeType, old, new interface{}) FieldChange {
+	return FieldChange{
+		Path:     formatPath(path),
+		Change:   change,
+		OldValue: old,
+		NewValue: new,
+		Masked:   isRedacted(old) || isRedacted(new),
+		segments: path,
+	}
+}
+
+// appendSegment returns a copy of path extended with seg, so that recorded
+// changes never share backing arrays
+func appendSegment(path []pathSegment, seg pathSegment) []pathSegment {
+	result := make([]pathSegment, len(path)+1)
+	copy(result, path)
+	result[len(path)] = seg
+	return result
+}
+
+// normalizeValue converts mappings with non-string keys, which yaml.v3
+// decodes as map[interface{}]interface{}, into string-keyed maps
+func normalizeValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			t[k] = normalizeValue(child)
+		}
+		return t
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			m[fmt.Sprint(k)] = normalizeValue(child)
+		}
+		return m
+	case []interface{}:
+		for i, child := range t {
+			t[i] = normalizeValue(child)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// formatValue renders a value for display: scalars as written, strings
+// quoted only when needed, and mappings or lists as compact JSON
+func formatValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if t == "" || strings.ContainsAny(t, "\n\t") || strings.TrimSpace(t) != t {
+			return strconv.Quote(t)
+		}
+		return t
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// indent prefixes every line of s with prefix
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,266 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Origin classifies a change of a three-way comparison by the side it was
+// made on. The current manifests are "theirs", for example the render of
+// the main branch, and the proposed manifests are "ours", for example the
+// render of a pull request.
+type Origin string
+
+const (
+	// Ours is a change made only in the proposed manifests
+	Ours Origin = "ours"
+	// Theirs is a change made only in the current manifests
+	Theirs Origin = "theirs"
+	// Both is the same change made on both sides
+	Both Origin = "both"
+	// Conflict is a change made differently on the two sides, or a change
+	// to a field whose parent or child was changed on the other side
+	Conflict Origin = "conflict"
+)
+
+// ThreeWayChange is a field change relative to the base manifests,
+// classified by the side it was made on
+type ThreeWayChange struct {
+	Path   string
+	Origin Origin
+	// Theirs and Ours are the changes from base to the current and the
+	// proposed manifests; either is nil when that side did not change Path
+	Theirs *FieldChange
+	Ours   *FieldChange
+}
+
+// String formats the change as "[origin] path: old -> new". Conflicting
+// changes show the change of each side.
+func (c ThreeWayChange) String() string {
+	switch {
+	case c.Theirs != nil && c.Ours != nil && c.Origin == Conflict:
+		return fmt.Sprintf("[conflict] %s: theirs %s, ours %s", c.Ours.displayPath(), c.Theirs.describe(), c.Ours.describe())
+	case c.Ours != nil && c.Origin == Conflict:
+		return fmt.Sprintf("[conflict] %s (ours)", c.Ours)
+	case c.Theirs != nil && c.Origin == Conflict:
+		return fmt.Sprintf("[conflict] %s (theirs)", c.Theirs)
+	case c.Ours != nil:
+		return fmt.Sprintf("[%s] %s", c.Origin, c.Ours)
+	default:
+		return fmt.Sprintf("[%s] %s", c.Origin, c.Theirs)
+	}
+}
+
+// ThreeWayResource is the three-way comparison result for a single
+// resource. Theirs and Ours describe how the resource changed from base on
+// each side; a resource added or removed as a whole has a single change
+// at the empty path.
+type ThreeWayResource struct {
+	ID      ResourceID
+	Theirs  ChangeType
+	Ours    ChangeType
+	Changes []ThreeWayChange
+}
+
+// HasConflicts reports whether any change of the resource conflicts
+func (r ThreeWayResource) HasConflicts() bool {
+	for _, c := range r.Changes {
+		if c.Origin == Conflict {
+			return true
+		}
+	}
+	return false
+}
+
+// ThreeWayResult is the result of CompareThreeWay
+type ThreeWayResult struct {
+	theirs    *DiffResult
+	ours      *DiffResult
+	resources []ThreeWayResource
+}
+
+// Resources returns the resources changed on either side, base resources
+// first in their original order followed by added resources
+func (r *ThreeWayResult) Resources() []ThreeWayResource {
+	return r.resources
+}
+
+// Theirs returns the comparison of the base with the current manifests
+func (r *ThreeWayResult) Theirs() *DiffResult {
+	return r.theirs
+}
+
+// Ours returns the comparison of the base with the proposed manifests
+func (r *ThreeWayResult) Ours() *DiffResult {
+	return r.ours
+}
+
+// HasConflicts reports whether any change conflicts
+func (r *ThreeWayResult) HasConflicts() bool {
+	for _, res := range r.resources {
+		if res.HasConflicts() {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the classified changes one per line, grouped under their
+// resource
+func (r *ThreeWayResult) String() string {
+	var lines []string
+	for _, res := range r.resources {
+		lines = append(lines, fmt.Sprintf("%s (theirs %s, ours %s):", res.ID, res.Theirs, res.Ours))
+		for _, c := range res.Changes {
+			lines = append(lines, indent(c.String(), "  "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CompareThreeWay compares the current and the proposed manifests against
+// their common base, for example the last deployed render, and classifies
+// every change by the side it was made on. Resources are matched by
+// identity and renames are detected as in CompareMultipleManifests.
+func (d *Diff) CompareThreeWay(base, current, proposed string) (*ThreeWayResult, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	theirs, err := d.CompareMultipleManifests(base, current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare base with current manifests: %w", err)
+	}
+	ours, err := d.CompareMultipleManifests(base, proposed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare base with proposed manifests: %w", err)
+	}
+
+	result := &ThreeWayResult{theirs: theirs, ours: ours}
+	add := func(t, o *ResourceDiff) {
+		if res, changed := mergeResources(t, o); changed {
+			result.resources = append(result.resources, res)
+		}
+	}
+
+	// Both comparisons list one entry per base document, in base order,
+	// before the added resources
+	t, o := theirs.resources, ours.resources
+	i := 0
+	for ; i < len(t) && i < len(o) && t[i].Change != Added && o[i].Change != Added; i++ {
+		add(&t[i], &o[i])
+	}
+
+	// Resources added on both sides are matched by identity
+	oursAdded := make(map[ResourceID][]int)
+	for j := i; j < len(o); j++ {
+		oursAdded[o[j].ID] = append(oursAdded[o[j].ID], j)
+	}
+	matched := make([]bool, len(o))
+	for j := i; j < len(t); j++ {
+		candidates := oursAdded[t[j].ID]
+		if len(candidates) == 0 {
+			add(&t[j], nil)
+			continue
+		}
+		oursAdded[t[j].ID] = candidates[1:]
+		matched[candidates[0]] = true
+		add(&t[j], &o[candidates[0]])
+	}
+	for j := i; j < len(o); j++ {
+		if !matched[j] {
+			add(nil, &o[j])
+		}
+	}
+
+	return result, nil
+}
+
+// mergeResources classifies the changes of one resource on each side. A
+// nil side did not add the resource. It reports false when neither side
+// changed the resource.
+func mergeResources(theirs, ours *ResourceDiff) (ThreeWayResource, bool) {
+	res := ThreeWayResource{Theirs: Unchanged, Ours: Unchanged}
+	var theirsChanges, oursChanges []FieldChange
+	if theirs != nil {
+		res.ID, res.Theirs, theirsChanges = theirs.ID, theirs.Change, theirs.Result.changes
+	}
+	// The identity on the proposed side takes precedence unless the
+	// resource was removed there
+	if ours != nil {
+		if res.ID == (ResourceID{}) || ours.Change != Removed {
+			res.ID = ours.ID
+		}
+		res.Ours, oursChanges = ours.Change, ours.Result.changes
+	}
+
+	if res.Theirs == Unchanged && res.Ours == Unchanged {
+		return res, false
+	}
+	res.Changes = mergeChanges(theirsChanges, oursChanges)
+	return res, true
+}
+
+// mergeChanges pairs the field changes of both sides by path. Changes to
+// the same path are the same change when they agree on the new value, and
+// a change to a path within a subtree changed on the other side conflicts.
+func mergeChanges(theirs, ours []FieldChange) []ThreeWayChange {
+	var changes []ThreeWayChange
+	oursPaired := make([]bool, len(ours))
+	oursConflicts := make([]bool, len(ours))
+
+	for i := range theirs {
+		c := ThreeWayChange{Path: theirs[i].Path, Origin: Theirs, Theirs: &theirs[i]}
+		conflict := false
+		for j := range ours {
+			switch {
+			case theirs[i].Path == ours[j].Path:
+				oursPaired[j] = true
+				c.Ours = &ours[j]
+				c.Origin = Both
+				if theirs[i].Change != ours[j].Change || !reflect.DeepEqual(theirs[i].NewValue, ours[j].NewValue) {
+					conflict = true
+				}
+			case isPathPrefix(theirs[i].segments, ours[j].segments) || isPathPrefix(ours[j].segments, theirs[i].segments):
+				oursConflicts[j] = true
+				conflict = true
+			}
+		}
+		if conflict {
+			c.Origin = Conflict
+		}
+		changes = append(changes, c)
+	}
+
+	for j := range ours {
+		if oursPaired[j] {
+			continue
+		}
+		c := ThreeWayChange{Path: ours[j].Path, Origin: Ours, Ours: &ours[j]}
+		if oursConflicts[j] {
+			c.Origin = Conflict
+		}
+		changes = append(changes, c)
+	}
+
+	sort.SliceStable(changes, func(a, b int) bool {
+		return changes[a].Path < changes[b].Path
+	})
+	return changes
+}
+
+// isPathPrefix reports whether prefix is a proper prefix of path. List
+// elements identified by merge key match whatever their index.
+func isPathPrefix(prefix, path []pathSegment) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i, seg := range prefix {
+		if path[i].key != seg.key || path[i].list != seg.list || path[i].field != seg.field {
+			return false
+		}
+	}
+	return true
+}
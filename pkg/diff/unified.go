@@ -0,0 +1,144 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// devNull is the file header label used for a side that does not exist
+const devNull = "/dev/null"
+
+// noNewlineMarker follows a line that ends its input without a newline
+const noNewlineMarker = "\\ No newline at end of file"
+
+// Line is a single line of a hunk
+type Line struct {
+	// Op is ' ' for context, '-' for a removed line and '+' for an added line
+	Op   rune
+	Text string
+	// OldNumber and NewNumber are the 1-based line numbers in the old and
+	// new input, or 0 when the line does not exist on that side
+	OldNumber int
+	NewNumber int
+	// Segments splits a removed or added line paired with a line on the
+	// other side into unchanged and changed parts. It is only set when
+	// intra-line refinement is enabled with WithIntraLineDiff.
+	Segments []Segment
+	// NoNewline is set on the last line of an input that does not end
+	// with a newline. Unified output follows it with a
+	// "\\ No newline at end of file" line.
+	NoNewline bool
+}
+
+// Hunk is a contiguous region of a diff together with its surrounding
+// context lines. Start positions are 1-based; an empty range is addressed
+// by the line preceding it, as in unified diff headers.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Header returns the "@@ -l,s +l,s @@" line of the hunk, omitting lengths
+// of one as GNU diff does
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, length int) string {
+	if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+// buildHunks groups an edit script into hunks, keeping up to contextLines
+// unchanged lines around each change. Changes separated by no more than
+// twice the context radius share a hunk, as in GNU diff.
+func (d *Diff) buildHunks(diffs []diffLine) []Hunk {
+	var changes []int
+	for i, diff := range diffs {
+		if diff.op != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	// Number of old and new lines preceding each entry
+	oldPos := make([]int, len(diffs)+1)
+	newPos := make([]int, len(diffs)+1)
+	for i, diff := range diffs {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if diff.op != '+' {
+			oldPos[i+1]++
+		}
+		if diff.op != '-' {
+			newPos[i+1]++
+		}
+	}
+
+	var hunks []Hunk
+	first := 0
+	for i := 1; i <= len(changes); i++ {
+		if i < len(changes) && changes[i]-changes[i-1]-1 <= 2*d.contextLines {
+			continue
+		}
+
+		start := max(changes[first]-d.contextLines, 0)
+		end := min(changes[i-1]+d.contextLines+1, len(diffs))
+		h := Hunk{
+			OldStart: oldPos[start] + 1,
+			OldLines: oldPos[end] - oldPos[start],
+			NewStart: newPos[start] + 1,
+			NewLines: newPos[end] - newPos[start],
+		}
+		for j := start; j < end; j++ {
+			line := Line{Op: diffs[j].op, Text: diffs[j].text, NoNewline: diffs[j].noNewline}
+			if diffs[j].op != '+' {
+				line.OldNumber = oldPos[j] + 1
+			}
+			if diffs[j].op != '-' {
+				line.NewNumber = newPos[j] + 1
+			}
+			h.Lines = append(h.Lines, line)
+		}
+		// An empty range is addressed by the line preceding it
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+		hunks = append(hunks, h)
+		first = i
+	}
+
+	return hunks
+}
+
+// formatUnifiedDiff renders hunks in unified diff format. File headers are
+// written only when at least one label is set.
+func formatUnifiedDiff(hunks []Hunk, oldLabel, newLabel string) string {
+	var result strings.Builder
+
+	if oldLabel != "" || newLabel != "" {
+		fmt.Fprintf(&result, "--- %s\n+++ %s\n", oldLabel, newLabel)
+	}
+
+	for _, h := range hunks {
+		result.WriteString(h.Header())
+		result.WriteString("\n")
+		for _, line := range h.Lines {
+			fmt.Fprintf(&result, "%c%s\n", line.Op, line.Text)
+			if line.NoNewline {
+				result.WriteString(noNewlineMarker + "\n")
+			}
+		}
+	}
+
+	return strings.TrimSuffix(result.String(), "\n")
+}
@@ -0,0 +1,127 @@
+package helmrender
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// capabilitiesFile is a captured capabilities file in one of the formats
+// accepted by RenderOptions.CapabilitiesFile
+type capabilitiesFile struct {
+	Kind        string   `yaml:"kind"`
+	KubeVersion string   `yaml:"kubeVersion"`
+	APIVersions []string `yaml:"apiVersions"`
+
+	// Versions is set by the /api discovery document
+	Versions []string `yaml:"versions"`
+	// Groups is set by the /apis discovery document
+	Groups []struct {
+		Versions []struct {
+			GroupVersion string `yaml:"groupVersion"`
+		} `yaml:"versions"`
+	} `yaml:"groups"`
+	// ServerVersion is set by kubectl version -o yaml
+	ServerVersion struct {
+		GitVersion string `yaml:"gitVersion"`
+	} `yaml:"serverVersion"`
+}
+
+// capabilities returns the capabilities to render with: Helm's defaults,
+// with the Kubernetes version and API versions of opts. The API versions
+// listed by a capabilities file replace Helm's default API versions, so
+// that APIs the cluster does not serve are reported absent.
+func capabilities(opts RenderOptions) (*chartutil.Capabilities, error) {
+	caps := chartutil.DefaultCapabilities.Copy()
+	caps.APIVersions = append(chartutil.VersionSet(nil), caps.APIVersions...)
+
+	kubeVersion := opts.KubeVersion
+	if opts.CapabilitiesFile != "" {
+		fileVersion, fileAPIVersions, err := loadCapabilitiesFile(opts.CapabilitiesFile)
+		if err != nil {
+			return nil, err
+		}
+		if kubeVersion == "" {
+			kubeVersion = fileVersion
+		}
+		if len(fileAPIVersions) > 0 {
+			// The core group is served by every cluster, but the /apis
+			// discovery document does not list it
+			caps.APIVersions = append(chartutil.VersionSet{"v1"}, fileAPIVersions...)
+		}
+	}
+	caps.APIVersions = append(caps.APIVersions, opts.APIVersions...)
+
+	if kubeVersion == "" {
+		return caps, nil
+	}
+	parsed, err := chartutil.ParseKubeVersion(kubeVersion)
+	if err != nil {
+		return nil, &InvalidKubeVersionError{Version: kubeVersion, Err: err}
+	}
+	caps.KubeVersion = *parsed
+	return caps, nil
+}
+
+// loadCapabilitiesFile reads the Kubernetes version and API versions of a
+// cluster from a capabilities file
+func loadCapabilitiesFile(filename string) (string, []string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", nil, &InvalidCapabilitiesError{File: filename, Err: err}
+	}
+
+	// A document that is not a mapping is a list of API versions, one per
+	// line, as written by kubectl api-versions
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return "", nil, &InvalidCapabilitiesError{File: filename, Err: err}
+	}
+	if len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+		return "", apiVersionLines(data), nil
+	}
+
+	var file capabilitiesFile
+	if err := node.Decode(&file); err != nil {
+		return "", nil, &InvalidCapabilitiesError{File: filename, Err: err}
+	}
+
+	kubeVersion := file.KubeVersion
+	if kubeVersion == "" {
+		kubeVersion = file.ServerVersion.GitVersion
+	}
+	apiVersions := file.APIVersions
+	switch file.Kind {
+	case "APIVersions":
+		apiVersions = append(apiVersions, file.Versions...)
+	case "APIGroupList":
+		for _, group := range file.Groups {
+			for _, version := range group.Versions {
+				apiVersions = append(apiVersions, version.GroupVersion)
+			}
+		}
+	case "":
+	default:
+		return "", nil, &InvalidCapabilitiesError{File: filename, Err: fmt.Errorf("unsupported kind %q", file.Kind)}
+	}
+	return kubeVersion, apiVersions, nil
+}
+
+// apiVersionLines returns the non-empty lines of data, skipping comments
+func apiVersionLines(data []byte) []string {
+	var versions []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		versions = append(versions, line)
+	}
+	return versions
+}
@@ -0,0 +1,60 @@
+package helmrender
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mishkaexe/lemuria/pkg/diff"
+)
+
+// CompareResult contains the renders of two sets of options and their
+// differences
+type CompareResult struct {
+	Old *RenderResult
+	New *RenderResult
+	// Manifests is the resource-level comparison of the rendered manifests
+	Manifests *diff.DiffResult
+	// Notes is the line diff of the rendered NOTES.txt
+	Notes *diff.DiffResult
+}
+
+// HasDifferences reports whether the manifests or the notes differ
+func (r *CompareResult) HasDifferences() bool {
+	return r.Manifests.HasDifferences() || r.Notes.HasDifferences()
+}
+
+// Compare renders a chart with both sets of options, for example with
+// different values files, chart paths or releases, and compares the
+// results resource by resource. diffOpts configure the comparison.
+func (r *ChartRenderer) Compare(oldOpts, newOpts RenderOptions, diffOpts ...diff.Option) (*CompareResult, error) {
+	oldResult, err := r.Render(oldOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render old chart: %w", err)
+	}
+	newResult, err := r.Render(newOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render new chart: %w", err)
+	}
+
+	d := diff.New(diffOpts...)
+	manifests, err := d.CompareMultipleManifests(joinManifests(oldResult.Manifests), joinManifests(newResult.Manifests))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare manifests: %w", err)
+	}
+	notes, err := d.CompareStrings(oldResult.Notes, newResult.Notes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare notes: %w", err)
+	}
+
+	return &CompareResult{
+		Old:       oldResult,
+		New:       newResult,
+		Manifests: manifests,
+		Notes:     notes,
+	}, nil
+}
+
+// joinManifests joins separated manifests into a multi-document YAML string
+func joinManifests(manifests []string) string {
+	return strings.Join(manifests, "\n---\n")
+}
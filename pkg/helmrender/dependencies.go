@@ -0,0 +1,216 @@
+package helmrender
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// chartLocation is where a chart was loaded from, against which file://
+// dependencies are resolved. A nil location has no file:// dependencies.
+type chartLocation struct {
+	fsys fs.FS // nil for the local filesystem
+	dir  string
+}
+
+// load loads the chart at a path relative to the location
+func (l *chartLocation) load(ctx context.Context, rel string) (*chart.Chart, *chartLocation, error) {
+	if l == nil {
+		return nil, nil, fmt.Errorf("file:// dependencies need a chart directory")
+	}
+	if l.fsys != nil {
+		dir := path.Join(l.dir, rel)
+		c, err := loadChartFS(ctx, l.fsys, dir)
+		return c, &chartLocation{fsys: l.fsys, dir: dir}, err
+	}
+
+	dir := rel
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(l.dir, filepath.FromSlash(rel))
+	}
+	c, err := loader.Load(dir)
+	return c, directoryLocation(dir), err
+}
+
+// subchart returns the location of a subchart vendored in charts/
+func (l *chartLocation) subchart(name string) *chartLocation {
+	if l == nil {
+		return nil
+	}
+	if l.fsys != nil {
+		return &chartLocation{fsys: l.fsys, dir: path.Join(l.dir, "charts", name)}
+	}
+	return directoryLocation(filepath.Join(l.dir, "charts", name))
+}
+
+// directoryLocation returns the location of a chart on the local
+// filesystem, or nil when it is a packaged chart
+func directoryLocation(chartPath string) *chartLocation {
+	if info, err := os.Stat(chartPath); err != nil || !info.IsDir() {
+		return nil
+	}
+	return &chartLocation{dir: chartPath}
+}
+
+// resolveDependencies adds the dependencies listed in Chart.yaml that are
+// not vendored in charts/, loading them from file:// paths or from the
+// local repositories, and checks that all of them satisfy their version
+// constraints. Conditions, tags, aliases and import-values are applied
+// when the chart is rendered. It returns the error of ctx once ctx is done.
+func resolveDependencies(ctx context.Context, c *chart.Chart, loc *chartLocation, repositories map[string]string) error {
+	if c.Metadata == nil || len(c.Metadata.Dependencies) == 0 {
+		return nil
+	}
+
+	vendored := make(map[string]*chart.Chart)
+	for _, sub := range c.Dependencies() {
+		vendored[sub.Name()] = sub
+	}
+
+	depErr := &DependencyError{Chart: c.Name()}
+	locations := make(map[*chart.Chart]*chartLocation)
+	for _, dep := range c.Metadata.Dependencies {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sub, ok := vendored[dep.Name]
+		if ok {
+			locations[sub] = loc.subchart(dep.Name)
+		} else {
+			var subLoc *chartLocation
+			var err error
+			sub, subLoc, err = fetchDependency(ctx, dep, loc, repositories)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err != nil {
+				depErr.Missing = append(depErr.Missing, MissingDependency{
+					Name:       dep.Name,
+					Version:    dep.Version,
+					Repository: dep.Repository,
+					Err:        err,
+				})
+				continue
+			}
+			c.AddDependency(sub)
+			vendored[dep.Name] = sub
+			locations[sub] = subLoc
+		}
+
+		if !versionSatisfies(dep.Version, sub.Metadata.Version) {
+			depErr.Mismatched = append(depErr.Mismatched, MismatchedDependency{
+				Name:    dep.Name,
+				Version: dep.Version,
+				Found:   sub.Metadata.Version,
+			})
+		}
+	}
+	if len(depErr.Missing) > 0 || len(depErr.Mismatched) > 0 {
+		return depErr
+	}
+
+	for _, sub := range c.Dependencies() {
+		if err := resolveDependencies(ctx, sub, locations[sub], repositories); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchDependency loads a dependency that is not vendored in charts/
+func fetchDependency(ctx context.Context, dep *chart.Dependency, loc *chartLocation, repositories map[string]string) (*chart.Chart, *chartLocation, error) {
+	if rel, ok := strings.CutPrefix(dep.Repository, "file://"); ok {
+		c, subLoc, err := loc.load(ctx, rel)
+		if err != nil {
+			return nil, nil, err
+		}
+		if c.Name() != dep.Name {
+			return nil, nil, fmt.Errorf("chart at %s is named %s", dep.Repository, c.Name())
+		}
+		return c, subLoc, nil
+	}
+
+	if dep.Repository == "" {
+		return nil, nil, fmt.Errorf("not found in charts/")
+	}
+	dir, ok := repositoryDir(dep.Repository, repositories)
+	if !ok {
+		return nil, nil, fmt.Errorf("repository %s is not available locally", dep.Repository)
+	}
+	c, err := loadFromRepository(dir, dep.Name, dep.Version)
+	return c, nil, err
+}
+
+// repositoryDir returns the local directory of a dependency repository,
+// given by name as "@name" or "alias:name", or by URL
+func repositoryDir(repository string, repositories map[string]string) (string, bool) {
+	name := repository
+	if n, ok := strings.CutPrefix(repository, "@"); ok {
+		name = n
+	} else if n, ok := strings.CutPrefix(repository, "alias:"); ok {
+		name = n
+	}
+	if dir, ok := repositories[name]; ok {
+		return dir, true
+	}
+	dir, ok := repositories[strings.TrimSuffix(name, "/")]
+	return dir, ok
+}
+
+// versionSatisfies reports whether version satisfies a dependency version
+// constraint; an empty constraint accepts any version
+func versionSatisfies(constraint, version string) bool {
+	if constraint == "" {
+		return true
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return c.Check(v)
+}
+
+// VendorDependencies resolves the dependencies of the chart directory at
+// chartPath like Render does and writes those not yet vendored to its
+// charts/ directory as packaged charts, as helm dependency build does
+func VendorDependencies(chartPath string, repositories map[string]string) error {
+	c, err := loader.Load(chartPath)
+	if err != nil {
+		return &ChartNotFoundError{Path: chartPath}
+	}
+	vendored := make(map[*chart.Chart]bool)
+	for _, sub := range c.Dependencies() {
+		vendored[sub] = true
+	}
+
+	if err := resolveDependencies(context.Background(), c, directoryLocation(chartPath), repositories); err != nil {
+		return err
+	}
+
+	chartsDir := filepath.Join(chartPath, "charts")
+	for _, sub := range c.Dependencies() {
+		if vendored[sub] {
+			continue
+		}
+		if err := os.MkdirAll(chartsDir, 0o755); err != nil {
+			return err
+		}
+		if _, err := chartutil.Save(sub, chartsDir); err != nil {
+			return fmt.Errorf("failed to vendor dependency %s: %w", sub.Name(), err)
+		}
+	}
+	return nil
+}
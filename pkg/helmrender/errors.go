@@ -1,6 +1,9 @@
 package helmrender
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // ChartNotFoundError is returned when a chart cannot be found
 type ChartNotFoundError struct {
@@ -29,4 +32,127 @@ type RenderError struct {
 
 func (e RenderError) Error() string {
 	return fmt.Sprintf("failed to render chart %s: %v", e.Chart, e.Err)
-}
\ No newline at end of file
+}
+
+// InvalidOverrideError is returned when a --set style override is invalid
+type InvalidOverrideError struct {
+	Flag  string
+	Value string
+	Err   error
+}
+
+func (e InvalidOverrideError) Error() string {
+	return fmt.Sprintf("invalid --%s override %q: %v", e.Flag, e.Value, e.Err)
+}
+
+// ChartLoadError is returned when a chart archive or file system does not
+// hold a valid chart
+type ChartLoadError struct {
+	Source string
+	Err    error
+}
+
+func (e ChartLoadError) Error() string {
+	return fmt.Sprintf("failed to load chart from %s: %v", e.Source, e.Err)
+}
+
+// ChartResolveError is returned when a chart reference cannot be resolved
+// to a chart in a local repository
+type ChartResolveError struct {
+	Ref     string
+	Version string
+	Err     error
+}
+
+func (e ChartResolveError) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("failed to resolve chart %s: %v", e.Ref, e.Err)
+	}
+	return fmt.Sprintf("failed to resolve chart %s version %s: %v", e.Ref, e.Version, e.Err)
+}
+
+// DependencyError is returned when dependencies listed in Chart.yaml are
+// neither vendored in charts/ nor available locally, or do not satisfy
+// their version constraints
+type DependencyError struct {
+	Chart      string
+	Missing    []MissingDependency
+	Mismatched []MismatchedDependency
+}
+
+// MissingDependency is a dependency that could not be found
+type MissingDependency struct {
+	Name       string
+	Version    string
+	Repository string
+	Err        error
+}
+
+// MismatchedDependency is a dependency whose version does not satisfy the
+// constraint in Chart.yaml
+type MismatchedDependency struct {
+	Name    string
+	Version string
+	Found   string
+}
+
+func (e DependencyError) Error() string {
+	var problems []string
+	for _, m := range e.Missing {
+		problems = append(problems, fmt.Sprintf("%s %s missing (%v)", m.Name, m.Version, m.Err))
+	}
+	for _, m := range e.Mismatched {
+		problems = append(problems, fmt.Sprintf("%s %s found version %s", m.Name, m.Version, m.Found))
+	}
+	return fmt.Sprintf("chart %s has unresolved dependencies: %s", e.Chart, strings.Join(problems, ", "))
+}
+
+// InvalidCapabilitiesError is returned when a capabilities file cannot be
+// read or parsed
+type InvalidCapabilitiesError struct {
+	File string
+	Err  error
+}
+
+func (e InvalidCapabilitiesError) Error() string {
+	return fmt.Sprintf("invalid capabilities file %s: %v", e.File, e.Err)
+}
+
+// InvalidKubeVersionError is returned when the Kubernetes version to render
+// for is not a valid version
+type InvalidKubeVersionError struct {
+	Version string
+	Err     error
+}
+
+func (e InvalidKubeVersionError) Error() string {
+	return fmt.Sprintf("invalid kube version %q: %v", e.Version, e.Err)
+}
+
+// RenderTimeoutError is returned when the context of a render is cancelled
+// or its deadline passes before the chart is rendered. It unwraps to the
+// error of the context, such as context.DeadlineExceeded.
+type RenderTimeoutError struct {
+	Chart string
+	Err   error
+}
+
+func (e RenderTimeoutError) Error() string {
+	return fmt.Sprintf("rendering chart %s was interrupted: %v", e.Chart, e.Err)
+}
+
+func (e RenderTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// RendererBusyError is returned when every render slot of a ChartRenderer
+// is held by a render abandoned by RenderContext whose templates are still
+// executing
+type RendererBusyError struct {
+	Chart string
+	Limit int
+}
+
+func (e RendererBusyError) Error() string {
+	return fmt.Sprintf("cannot render chart %s: all %d renders of the renderer are still executing abandoned templates", e.Chart, e.Limit)
+}
@@ -1,3 +1,81 @@
 package helmrender
 
-// TODO: Add additional configuration options and utilities
\ No newline at end of file
+import (
+	"io"
+	"io/fs"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// RenderOptions contains options for rendering a Helm chart
+type RenderOptions struct {
+	// ChartPath is a chart directory or packaged chart archive. When
+	// ChartFS is set it is resolved within ChartFS, the root by default.
+	ChartPath string
+	// ChartFS holds the chart, for example an embed.FS. The .helmignore
+	// file of a chart loaded from ChartFS is not applied.
+	ChartFS fs.FS
+	// ChartArchive is read as a packaged chart archive. A reader can only
+	// be rendered once; load the chart with LoadChart to render it again.
+	ChartArchive io.Reader
+	// Chart is an already loaded chart. It is not modified by rendering.
+	Chart *chart.Chart
+	// ChartRef names a chart as "repo/name" in one of Repositories, which
+	// map repository names to local directories. ChartVersion is an exact
+	// version or a semver constraint such as ^1.4; the latest stable
+	// version is used when it is empty.
+	ChartRef     string
+	ChartVersion string
+	Repositories map[string]string
+
+	// ValuesFiles are read as by helm template -f, so "-" reads stdin and
+	// URLs are fetched. Values are merged after them like one more values
+	// file, keeping their Go types.
+	ValuesFiles []string
+	Values      map[string]interface{}
+	Namespace   string
+	ReleaseName string
+
+	// KubeVersion is the Kubernetes version the chart is rendered for, such
+	// as 1.30 or v1.27.3, as seen by .Capabilities.KubeVersion and the
+	// kubeVersion constraint of Chart.yaml. Helm's default is used when it
+	// is empty.
+	KubeVersion string
+	// APIVersions are available in addition to the API versions Helm knows
+	// by default, or to those of CapabilitiesFile, as with helm template
+	// --api-versions. Entries are group
+	// versions such as monitoring.coreos.com/v1 or resources such as
+	// monitoring.coreos.com/v1/ServiceMonitor, for .Capabilities.APIVersions.Has.
+	APIVersions []string
+	// CapabilitiesFile is a capabilities capture of a cluster: the output
+	// of kubectl api-versions, the /api or /apis discovery document, the
+	// output of kubectl version -o yaml, or a YAML document such as
+	//
+	//	kubeVersion: v1.30.2
+	//	apiVersions:
+	//	  - apps/v1
+	//	  - monitoring.coreos.com/v1/ServiceMonitor
+	//
+	// The API versions of the file, plus the core v1, replace the API
+	// versions Helm knows by default, so that removed APIs such as
+	// policy/v1beta1 are absent; a file without API versions keeps them.
+	// KubeVersion takes precedence over the version of the file and
+	// APIVersions add to its API versions.
+	CapabilitiesFile string
+
+	// Overrides in the syntax of the Helm flags of the same name, such as
+	// image.tag=1.2.3 or ingress.hosts[0].host=example.com. They are
+	// applied after ValuesFiles and Values by Helm's own parsers, in the
+	// order of helm template: SetJSON, Set, SetString, SetFile and
+	// SetLiteral, later ones taking precedence.
+	//
+	// Set infers the type of values, SetString keeps them as strings,
+	// SetJSON takes JSON values such as a={"b":1}, SetFile reads each
+	// value from the named file and SetLiteral takes values verbatim,
+	// without splitting at commas.
+	Set        []string
+	SetString  []string
+	SetJSON    []string
+	SetFile    []string
+	SetLiteral []string
+}
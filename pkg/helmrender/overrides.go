@@ -0,0 +1,103 @@
+package helmrender
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// mergeValueFiles reads the values files in order and merges them as
+// Helm's value options do. Every file is read once, so the file that
+// cannot be read or parsed is reported.
+func mergeValueFiles(files []string, providers getter.Providers) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	for _, file := range files {
+		fileValues, err := (&values.Options{ValueFiles: []string{file}}).MergeValues(providers)
+		if err != nil {
+			return nil, &InvalidValuesError{File: file, Err: err}
+		}
+		merged = mergeMaps(merged, fileValues)
+	}
+	return merged, nil
+}
+
+// applyOverrides parses the --set style overrides of opts into values with
+// Helm's strvals parsers, in the order Helm's value options apply them
+func applyOverrides(values map[string]interface{}, opts RenderOptions, providers getter.Providers) error {
+	readFile := func(path []rune) (interface{}, error) {
+		data, err := readValuesSource(string(path), providers)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+	overrides := []struct {
+		flag  string
+		items []string
+		parse func(s string, dest map[string]interface{}) error
+	}{
+		{"set-json", opts.SetJSON, strvals.ParseJSON},
+		{"set", opts.Set, strvals.ParseInto},
+		{"set-string", opts.SetString, strvals.ParseIntoString},
+		{"set-file", opts.SetFile, func(s string, dest map[string]interface{}) error {
+			return strvals.ParseIntoFile(s, dest, readFile)
+		}},
+		{"set-literal", opts.SetLiteral, strvals.ParseLiteralInto},
+	}
+
+	for _, o := range overrides {
+		for _, item := range o.items {
+			if err := o.parse(item, values); err != nil {
+				return &InvalidOverrideError{Flag: o.flag, Value: item, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// readValuesSource reads a --set-file source as Helm does: "-" reads stdin,
+// URLs with a scheme of the providers are fetched, other paths are local
+// files
+func readValuesSource(path string, providers getter.Providers) ([]byte, error) {
+	if strings.TrimSpace(path) == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := providers.ByScheme(u.Scheme)
+	if err != nil {
+		return os.ReadFile(path)
+	}
+	data, err := g.Get(path, getter.WithURL(path))
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// mergeMaps recursively merges two maps, with the second map taking
+// precedence, as Helm merges values files. Null values are kept so that
+// coalescing with the chart defaults removes the keys they are set for.
+func mergeMaps(base, override map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range override {
+		if overrideMap, ok := v.(map[string]interface{}); ok {
+			if baseMap, ok := result[k].(map[string]interface{}); ok {
+				result[k] = mergeMaps(baseMap, overrideMap)
+				continue
+			}
+		}
+		result[k] = v
+	}
+	return result
+}
@@ -1,30 +1,40 @@
 package helmrender
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
-	"gopkg.in/yaml.v3"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
-	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
 )
 
 // ChartRenderer handles rendering of Helm charts
 type ChartRenderer struct {
 	actionConfig *action.Configuration
 	settings     *cli.EnvSettings
+	slots        *renderSlots // nil without WithMaxRenders
 }
 
-// RenderOptions contains options for rendering a Helm chart
-type RenderOptions struct {
-	ChartPath   string
-	ValuesFiles []string
-	Values      map[string]interface{}
-	Namespace   string
-	ReleaseName string
+// RendererOption configures a ChartRenderer
+type RendererOption func(*ChartRenderer)
+
+// WithMaxRenders limits how many renders may execute templates at once,
+// counting renders abandoned by RenderContext until their templates
+// return, which bounds the CPU and memory that abandoned renders hold.
+// Renders are not limited by default; limits below one are raised to one.
+func WithMaxRenders(n int) RendererOption {
+	return func(r *ChartRenderer) {
+		r.slots = newRenderSlots(n)
+	}
 }
 
 // RenderResult contains the result of rendering a Helm chart
@@ -34,7 +44,7 @@ type RenderResult struct {
 }
 
 // NewRenderer creates a new ChartRenderer
-func NewRenderer() *ChartRenderer {
+func NewRenderer(opts ...RendererOption) *ChartRenderer {
 	settings := cli.New()
 	actionConfig := new(action.Configuration)
 
@@ -44,21 +54,46 @@ func NewRenderer() *ChartRenderer {
 		// as we're only using template rendering which doesn't require full cluster access
 	}
 
-	return &ChartRenderer{
+	r := &ChartRenderer{
 		actionConfig: actionConfig,
 		settings:     settings,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // Render renders a Helm chart with the given options
 func (r *ChartRenderer) Render(opts RenderOptions) (*RenderResult, error) {
+	return r.RenderContext(context.Background(), opts)
+}
+
+// RenderContext renders a Helm chart like Render, returning a
+// RenderTimeoutError as soon as ctx is cancelled or its deadline passes,
+// including while the chart and its dependencies are loaded.
+//
+// Helm cannot interrupt a template while it executes, so the templates are
+// rendered in a separate goroutine that RenderContext stops waiting for
+// when ctx is done. The evaluation of abandoned templates cannot be
+// stopped: the goroutine keeps its CPU and memory until the template
+// returns, and forever when it never does. Its result is discarded.
+//
+// With WithMaxRenders, each render holds one of the renderer's slots until
+// its templates return, abandoned or not. Renders wait for a free slot
+// until ctx is done, and fail fast with a RendererBusyError while every
+// slot is held by an abandoned render.
+func (r *ChartRenderer) RenderContext(ctx context.Context, opts RenderOptions) (*RenderResult, error) {
 	// Input validation
 	if err := r.validateOptions(opts); err != nil {
 		return nil, err
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, &RenderTimeoutError{Chart: chartName(opts, nil), Err: err}
+	}
 
 	// Load chart from filesystem
-	chart, err := r.loadChart(opts.ChartPath)
+	chart, err := loadChart(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -68,9 +103,12 @@ func (r *ChartRenderer) Render(opts RenderOptions) (*RenderResult, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, &RenderTimeoutError{Chart: chartName(opts, chart), Err: err}
+	}
 
 	// Render templates
-	manifests, notes, err := r.renderTemplates(chart, opts, values)
+	manifests, notes, err := r.renderTemplatesContext(ctx, chart, opts, values)
 	if err != nil {
 		return nil, err
 	}
@@ -81,98 +119,125 @@ func (r *ChartRenderer) Render(opts RenderOptions) (*RenderResult, error) {
 	}, nil
 }
 
+// Values returns the values the chart templates are rendered with, as
+// helm template computes them: the user values coalesced with the chart
+// defaults, including subchart defaults, import-values, the propagation of
+// global values and the removal of keys set to null
+func (r *ChartRenderer) Values(opts RenderOptions) (map[string]interface{}, error) {
+	chart, err := LoadChart(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := r.mergeValues(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := chartutil.ProcessDependenciesWithMerge(chart, values); err != nil {
+		return nil, &RenderError{Chart: chartName(opts, chart), Err: err}
+	}
+	coalesced, err := chartutil.CoalesceValues(chart, values)
+	if err != nil {
+		return nil, &RenderError{Chart: chartName(opts, chart), Err: err}
+	}
+
+	return coalesced, nil
+}
+
 // validateOptions validates the render options
 func (r *ChartRenderer) validateOptions(opts RenderOptions) error {
-	if opts.ChartPath == "" {
-		return fmt.Errorf("chart path cannot be empty")
+	if err := validateSource(opts); err != nil {
+		return err
 	}
 
 	if opts.ReleaseName == "" {
 		return fmt.Errorf("release name cannot be empty")
 	}
 
-	// Check if chart path exists
-	if _, err := os.Stat(opts.ChartPath); os.IsNotExist(err) {
-		return &ChartNotFoundError{Path: opts.ChartPath}
+	// Check if chart path exists on the filesystem
+	if opts.ChartFS == nil && opts.ChartArchive == nil && opts.Chart == nil && opts.ChartRef == "" {
+		if _, err := os.Stat(opts.ChartPath); os.IsNotExist(err) {
+			return &ChartNotFoundError{Path: opts.ChartPath}
+		}
 	}
 
 	return nil
 }
 
-// loadChart loads a Helm chart from the filesystem
-func (r *ChartRenderer) loadChart(chartPath string) (*chart.Chart, error) {
-	chart, err := loader.Load(chartPath)
+// mergeValues builds the user values as helm template does from its values
+// files and --set style flags, with Values merged after ValuesFiles
+func (r *ChartRenderer) mergeValues(opts RenderOptions) (map[string]interface{}, error) {
+	providers := getter.All(r.settings)
+	values, err := mergeValueFiles(opts.ValuesFiles, providers)
 	if err != nil {
-		return nil, &ChartNotFoundError{Path: chartPath}
+		return nil, err
 	}
-	return chart, nil
-}
 
-// mergeValues parses and merges values from files and inline values
-func (r *ChartRenderer) mergeValues(opts RenderOptions) (map[string]interface{}, error) {
-	values := make(map[string]interface{})
+	// Values are merged like one more values file, copied so that the
+	// overrides do not modify the caller's maps and lists
+	values = mergeMaps(values, copyValues(opts.Values))
 
-	// First, load values from files
-	for _, valuesFile := range opts.ValuesFiles {
-		fileValues, err := r.loadValuesFile(valuesFile)
-		if err != nil {
-			return nil, err
-		}
-		values = r.mergeMaps(values, fileValues)
-	}
-
-	// Then, merge inline values (they take precedence)
-	if opts.Values != nil {
-		values = r.mergeMaps(values, opts.Values)
+	if err := applyOverrides(values, opts, providers); err != nil {
+		return nil, err
 	}
-
 	return values, nil
 }
 
-// loadValuesFile loads and parses a YAML values file
-func (r *ChartRenderer) loadValuesFile(filename string) (map[string]interface{}, error) {
-	data, err := os.ReadFile(filename)
+// renderTemplatesContext renders the chart templates until ctx is done,
+// in a render slot when renders are limited
+func (r *ChartRenderer) renderTemplatesContext(ctx context.Context, chart *chart.Chart, opts RenderOptions, values map[string]interface{}) ([]string, string, error) {
+	slot, err := r.slots.acquire(ctx, chartName(opts, chart))
 	if err != nil {
-		return nil, &InvalidValuesError{File: filename, Err: err}
+		return nil, "", err
 	}
-
-	var values map[string]interface{}
-	if err := yaml.Unmarshal(data, &values); err != nil {
-		return nil, &InvalidValuesError{File: filename, Err: err}
+	if ctx.Done() == nil {
+		defer slot.release()
+		return r.renderTemplates(chart, opts, values)
 	}
 
-	return values, nil
-}
-
-// mergeMaps recursively merges two maps, with the second map taking precedence
-func (r *ChartRenderer) mergeMaps(base, override map[string]interface{}) map[string]interface{} {
-	result := make(map[string]interface{})
-
-	// Copy base map
-	for k, v := range base {
-		result[k] = v
+	type rendered struct {
+		manifests []string
+		notes     string
+		err       error
 	}
-
-	// Merge override map
-	for k, v := range override {
-		if existing, exists := result[k]; exists {
-			if existingMap, ok := existing.(map[string]interface{}); ok {
-				if overrideMap, ok := v.(map[string]interface{}); ok {
-					result[k] = r.mergeMaps(existingMap, overrideMap)
-					continue
-				}
-			}
-		}
-		result[k] = v
+	// Buffered so that the goroutine of an abandoned render does not block
+	done := make(chan rendered, 1)
+	go func() {
+		// The slot is released by the goroutine, so that an abandoned
+		// render holds it until its templates return
+		defer slot.release()
+		manifests, notes, err := r.renderTemplates(chart, opts, values)
+		done <- rendered{manifests, notes, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.manifests, res.notes, res.err
+	case <-ctx.Done():
+		slot.abandon()
+		return nil, "", &RenderTimeoutError{Chart: chartName(opts, chart), Err: ctx.Err()}
 	}
-
-	return result
 }
 
 // renderTemplates renders the chart templates using Helm
 func (r *ChartRenderer) renderTemplates(chart *chart.Chart, opts RenderOptions, values map[string]interface{}) ([]string, string, error) {
-	// Create template action
-	client := action.NewInstall(r.actionConfig)
+	caps, err := capabilities(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Create template action. In client-only mode Helm adds API versions to
+	// its defaults rather than replacing them, so the install runs as a dry
+	// run with the capabilities set up front, a client that does not reach
+	// the cluster and in-memory storage, as helm template does. Every render
+	// gets its own copy of the configuration to let renders, including
+	// abandoned ones, run concurrently.
+	config := *r.actionConfig
+	config.Capabilities = caps
+	config.KubeClient = &kubefake.PrintingKubeClient{Out: io.Discard}
+	config.Releases = storage.Init(driver.NewMemory())
+	client := action.NewInstall(&config)
 	client.DryRun = true
 	client.ReleaseName = opts.ReleaseName
 	client.Namespace = opts.Namespace
@@ -180,12 +245,11 @@ func (r *ChartRenderer) renderTemplates(chart *chart.Chart, opts RenderOptions,
 		client.Namespace = "default"
 	}
 	client.Replace = true
-	client.ClientOnly = true
 
 	// Render the templates
 	release, err := client.Run(chart, values)
 	if err != nil {
-		return nil, "", &RenderError{Chart: opts.ChartPath, Err: err}
+		return nil, "", &RenderError{Chart: chartName(opts, chart), Err: err}
 	}
 
 	// Separate manifests
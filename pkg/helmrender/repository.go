@@ -0,0 +1,160 @@
+package helmrender
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// resolveChart loads the chart named by a "repo/name" reference from a
+// local repository. A repository is either a Helm chart repository
+// directory, holding an index.yaml and the packaged charts it lists, or a
+// directory of OCI image layouts, one per chart name. The version is
+// selected as helm template selects it: an exact match, or else the latest
+// version satisfying the constraint, skipping prereleases unless the
+// constraint names one.
+func resolveChart(ref, version string, repositories map[string]string) (*chart.Chart, error) {
+	repoName, name, ok := strings.Cut(ref, "/")
+	if !ok || repoName == "" || name == "" || strings.Contains(name, "/") {
+		return nil, &ChartResolveError{Ref: ref, Version: version, Err: fmt.Errorf("expected a reference of the form repo/name")}
+	}
+	dir, ok := repositories[repoName]
+	if !ok {
+		return nil, &ChartResolveError{Ref: ref, Version: version, Err: fmt.Errorf("unknown repository %q", repoName)}
+	}
+
+	c, err := loadFromRepository(dir, name, version)
+	if err != nil {
+		return nil, &ChartResolveError{Ref: ref, Version: version, Err: err}
+	}
+	return c, nil
+}
+
+// loadFromRepository loads a chart from a local Helm chart repository or
+// directory of OCI layouts
+func loadFromRepository(dir, name, version string) (*chart.Chart, error) {
+	if _, err := os.Stat(filepath.Join(dir, "index.yaml")); err == nil {
+		return loadFromIndex(dir, name, version)
+	}
+	return loadFromOCILayout(filepath.Join(dir, name), version)
+}
+
+// loadFromIndex loads a chart from a Helm chart repository directory
+func loadFromIndex(dir, name, version string) (*chart.Chart, error) {
+	index, err := repo.LoadIndexFile(filepath.Join(dir, "index.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	cv, err := index.Get(name, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(cv.URLs) == 0 {
+		return nil, fmt.Errorf("chart %s %s has no URL", name, cv.Version)
+	}
+
+	// Repositories indexed with an absolute URL are served from the same
+	// directory, so only the file name is used
+	file := cv.URLs[0]
+	if u, err := url.Parse(file); err == nil && u.Scheme != "" {
+		if u.Scheme == "file" {
+			file = u.Path
+		} else {
+			file = path.Base(u.Path)
+		}
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, filepath.FromSlash(file))
+	}
+
+	return loader.LoadFile(file)
+}
+
+// loadFromOCILayout loads a chart from an OCI image layout directory whose
+// tags are chart versions
+func loadFromOCILayout(dir, version string) (*chart.Chart, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ocispec.ImageIndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("not a chart repository or OCI layout: %w", err)
+	}
+	var index ocispec.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid OCI layout index: %w", err)
+	}
+
+	// OCI tags cannot hold '+', which Helm stores as '_'
+	manifests := make(map[string]ocispec.Descriptor)
+	var tags []string
+	for _, desc := range index.Manifests {
+		tag := desc.Annotations[ocispec.AnnotationRefName]
+		if tag == "" {
+			continue
+		}
+		tag = strings.ReplaceAll(tag, "_", "+")
+		manifests[tag] = desc
+		tags = append(tags, tag)
+	}
+	sortVersionsDescending(tags)
+
+	tag, err := registry.GetTagMatchingVersionOrConstraint(tags, version)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ocispec.Manifest
+	if err := readBlob(dir, manifests[tag], &manifest); err != nil {
+		return nil, err
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == registry.ChartLayerMediaType || layer.MediaType == registry.LegacyChartLayerMediaType {
+			f, err := os.Open(blobPath(dir, layer))
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return loader.LoadArchive(f)
+		}
+	}
+	return nil, fmt.Errorf("manifest of %s has no chart layer", tag)
+}
+
+// readBlob decodes a JSON blob of an OCI layout
+func readBlob(dir string, desc ocispec.Descriptor, v interface{}) error {
+	data, err := os.ReadFile(blobPath(dir, desc))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// blobPath returns the path of a blob in an OCI layout
+func blobPath(dir string, desc ocispec.Descriptor) string {
+	return filepath.Join(dir, ocispec.ImageBlobsDir, desc.Digest.Algorithm().String(), desc.Digest.Encoded())
+}
+
+// sortVersionsDescending sorts tags from the highest semantic version to
+// the lowest, followed by tags that are not versions
+func sortVersionsDescending(tags []string) {
+	sort.SliceStable(tags, func(a, b int) bool {
+		va, errA := semver.NewVersion(tags[a])
+		vb, errB := semver.NewVersion(tags[b])
+		switch {
+		case errA != nil || errB != nil:
+			return errA == nil && errB != nil
+		default:
+			return va.GreaterThan(vb)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package helmrender
+
+import (
+	"context"
+	"sync"
+)
+
+// renderSlots limits the renders of a ChartRenderer whose templates are
+// executing, counting renders abandoned by RenderContext until their
+// templates return. Nil slots do not limit renders.
+type renderSlots struct {
+	mu        sync.Mutex
+	limit     int
+	held      int
+	abandoned int
+	// changed is closed and replaced when a slot is released or abandoned
+	changed chan struct{}
+}
+
+// renderSlot is a slot held by one render, nil when renders are not
+// limited
+type renderSlot struct {
+	slots     *renderSlots
+	abandoned bool
+	released  bool
+}
+
+func newRenderSlots(limit int) *renderSlots {
+	if limit < 1 {
+		limit = 1
+	}
+	return &renderSlots{limit: limit, changed: make(chan struct{})}
+}
+
+// acquire waits for a free slot until ctx is done. It fails fast with a
+// RendererBusyError when every slot is held by an abandoned render.
+func (s *renderSlots) acquire(ctx context.Context, chart string) (*renderSlot, error) {
+	if s == nil {
+		return nil, nil
+	}
+	for {
+		s.mu.Lock()
+		if s.held < s.limit {
+			s.held++
+			s.mu.Unlock()
+			return &renderSlot{slots: s}, nil
+		}
+		if s.abandoned >= s.limit {
+			s.mu.Unlock()
+			return nil, &RendererBusyError{Chart: chart, Limit: s.limit}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, &RenderTimeoutError{Chart: chart, Err: ctx.Err()}
+		}
+	}
+}
+
+// abandon marks the slot as held by a render nobody waits for anymore
+func (s *renderSlot) abandon() {
+	if s == nil {
+		return
+	}
+	s.slots.mu.Lock()
+	defer s.slots.mu.Unlock()
+	if s.released {
+		return
+	}
+	s.abandoned = true
+	s.slots.abandoned++
+	s.slots.notify()
+}
+
+// release frees the slot once the templates of its render have returned
+func (s *renderSlot) release() {
+	if s == nil {
+		return
+	}
+	s.slots.mu.Lock()
+	defer s.slots.mu.Unlock()
+	s.released = true
+	s.slots.held--
+	if s.abandoned {
+		s.slots.abandoned--
+	}
+	s.slots.notify()
+}
+
+// notify wakes the renders waiting for a slot; s.mu must be held
+func (s *renderSlots) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
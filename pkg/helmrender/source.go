@@ -0,0 +1,230 @@
+package helmrender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// LoadChart loads the chart selected by the chart source fields of opts,
+// so that it can be rendered repeatedly through RenderOptions.Chart.
+// Dependencies listed in Chart.yaml that are not vendored in charts/ are
+// loaded from file:// paths or from opts.Repositories.
+func LoadChart(opts RenderOptions) (*chart.Chart, error) {
+	return loadChart(context.Background(), opts)
+}
+
+// loadChart loads a chart like LoadChart, returning a RenderTimeoutError
+// once ctx is done
+func loadChart(ctx context.Context, opts RenderOptions) (*chart.Chart, error) {
+	if err := validateSource(opts); err != nil {
+		return nil, err
+	}
+
+	var c *chart.Chart
+	var loc *chartLocation
+	switch {
+	case opts.Chart != nil:
+		c = copyChart(opts.Chart)
+	case opts.ChartArchive != nil:
+		var err error
+		if c, err = loader.LoadArchive(opts.ChartArchive); err != nil {
+			return nil, &ChartLoadError{Source: "archive", Err: err}
+		}
+	case opts.ChartFS != nil:
+		var err error
+		if c, err = loadChartFS(ctx, opts.ChartFS, opts.ChartPath); err != nil {
+			return nil, interrupted(ctx, opts, err)
+		}
+		loc = &chartLocation{fsys: opts.ChartFS, dir: cleanFSPath(opts.ChartPath)}
+	case opts.ChartRef != "":
+		var err error
+		if c, err = resolveChart(opts.ChartRef, opts.ChartVersion, opts.Repositories); err != nil {
+			return nil, err
+		}
+	default:
+		var err error
+		if c, err = loader.Load(opts.ChartPath); err != nil {
+			return nil, &ChartNotFoundError{Path: opts.ChartPath}
+		}
+		loc = directoryLocation(opts.ChartPath)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, interrupted(ctx, opts, err)
+	}
+	if err := resolveDependencies(ctx, c, loc, opts.Repositories); err != nil {
+		return nil, interrupted(ctx, opts, err)
+	}
+	return c, nil
+}
+
+// interrupted returns a RenderTimeoutError in place of an error loading
+// the chart of opts once ctx is done
+func interrupted(ctx context.Context, opts RenderOptions, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return &RenderTimeoutError{Chart: chartName(opts, nil), Err: ctxErr}
+	}
+	return err
+}
+
+// validateSource checks that exactly one chart source is set. ChartPath
+// may be combined with ChartFS.
+func validateSource(opts RenderOptions) error {
+	sources := 0
+	if opts.ChartPath != "" || opts.ChartFS != nil {
+		sources++
+	}
+	if opts.ChartArchive != nil {
+		sources++
+	}
+	if opts.Chart != nil {
+		sources++
+	}
+	if opts.ChartRef != "" {
+		sources++
+	}
+
+	switch sources {
+	case 0:
+		return fmt.Errorf("chart path cannot be empty")
+	case 1:
+		return nil
+	default:
+		return fmt.Errorf("only one of chart path, chart archive, chart and chart reference can be set")
+	}
+}
+
+// loadChartFS loads a chart directory or archive from a file system,
+// stopping once ctx is done
+func loadChartFS(ctx context.Context, fsys fs.FS, name string) (*chart.Chart, error) {
+	name = cleanFSPath(name)
+
+	info, err := fs.Stat(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &ChartNotFoundError{Path: name}
+	}
+	if err != nil {
+		return nil, &ChartLoadError{Source: name, Err: err}
+	}
+
+	if !info.IsDir() {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, &ChartLoadError{Source: name, Err: err}
+		}
+		defer f.Close()
+		c, err := loader.LoadArchive(f)
+		if err != nil {
+			return nil, &ChartLoadError{Source: name, Err: err}
+		}
+		return c, nil
+	}
+
+	var files []*loader.BufferedFile
+	err = fs.WalkDir(fsys, name, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		rel := p
+		if name != "." {
+			rel = p[len(name)+1:]
+		}
+		files = append(files, &loader.BufferedFile{Name: rel, Data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, &ChartLoadError{Source: name, Err: err}
+	}
+
+	c, err := loader.LoadFiles(files)
+	if err != nil {
+		return nil, &ChartLoadError{Source: name, Err: err}
+	}
+	return c, nil
+}
+
+// cleanFSPath returns the path of a chart within a file system, the root
+// by default
+func cleanFSPath(name string) string {
+	if name == "" {
+		return "."
+	}
+	return path.Clean(name)
+}
+
+// copyChart copies the parts of a chart that rendering modifies: the
+// metadata and values of the chart and its dependencies, and the list of
+// dependencies, from which disabled ones are removed
+func copyChart(c *chart.Chart) *chart.Chart {
+	cp := *c
+	if c.Metadata != nil {
+		metadata := *c.Metadata
+		if c.Metadata.Dependencies != nil {
+			metadata.Dependencies = make([]*chart.Dependency, len(c.Metadata.Dependencies))
+			for i, dep := range c.Metadata.Dependencies {
+				d := *dep
+				metadata.Dependencies[i] = &d
+			}
+		}
+		cp.Metadata = &metadata
+	}
+	cp.Values = copyValues(c.Values)
+
+	deps := make([]*chart.Chart, len(c.Dependencies()))
+	for i, dep := range c.Dependencies() {
+		deps[i] = copyChart(dep)
+	}
+	cp.SetDependencies(deps...)
+	return &cp
+}
+
+// chartName describes the chart source in errors
+func chartName(opts RenderOptions, c *chart.Chart) string {
+	if opts.ChartRef != "" {
+		return opts.ChartRef
+	}
+	if opts.ChartPath != "" || c == nil {
+		return opts.ChartPath
+	}
+	return c.Name()
+}
+
+// copyValues returns a deep copy of a values map
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		result[k] = copyValue(v)
+	}
+	return result
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return copyValues(t)
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, elem := range t {
+			list[i] = copyValue(elem)
+		}
+		return list
+	default:
+		return v
+	}
+}
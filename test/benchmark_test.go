@@ -1,9 +1,12 @@
 package test
 
 import (
+	"fmt"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/mishkaexe/lemuria/pkg/diff"
 	"github.com/mishkaexe/lemuria/pkg/helmrender"
 	"github.com/stretchr/testify/require"
 )
@@ -249,3 +252,94 @@ func BenchmarkRender_ParallelSmallChart(b *testing.B) {
 	})
 }
 
+func BenchmarkCompareStrings_LargeManifestFewChanges(b *testing.B) {
+	old := generateLargeManifest(200, "1.20", 0)
+	new := generateLargeManifest(200, "1.20", 25)
+	benchmarkCompareStrings(b, old, new)
+}
+
+func BenchmarkCompareStrings_LargeManifestManyChanges(b *testing.B) {
+	old := generateLargeManifest(200, "1.20", 0)
+	new := generateLargeManifest(200, "1.21", 3)
+	benchmarkCompareStrings(b, old, new)
+}
+
+func BenchmarkCompareStrings_LargeManifestInsertedResources(b *testing.B) {
+	old := generateLargeManifest(200, "1.20", 0)
+	new := generateLargeManifest(20, "1.20", 0) + "\n---\n" + old
+	benchmarkCompareStrings(b, old, new)
+}
+
+func BenchmarkCompareMultipleManifests_LargeManifest(b *testing.B) {
+	d := diff.New()
+	old := generateLargeManifest(200, "1.20", 0)
+	new := generateLargeManifest(200, "1.21", 25)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := d.CompareMultipleManifests(old, new)
+		if err != nil {
+			b.Fatalf("CompareMultipleManifests failed: %v", err)
+		}
+		if !result.HasDifferences() {
+			b.Fatal("Expected differences")
+		}
+	}
+}
+
+func benchmarkCompareStrings(b *testing.B, old, new string) {
+	d := diff.New()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := d.CompareStrings(old, new)
+		if err != nil {
+			b.Fatalf("CompareStrings failed: %v", err)
+		}
+		if !result.HasDifferences() {
+			b.Fatal("Expected differences")
+		}
+	}
+	b.ReportMetric(float64(strings.Count(old, "\n")+1), "lines/op")
+}
+
+// generateLargeManifest renders count Deployments with the repeated list
+// entries typical of Kubernetes YAML. When every is non-zero, every n-th
+// Deployment gets an extra environment variable.
+func generateLargeManifest(count int, tag string, every int) string {
+	var sb strings.Builder
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			sb.WriteString("---\n")
+		}
+		fmt.Fprintf(&sb, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app-%d
+  labels:
+    app.kubernetes.io/name: app
+    app.kubernetes.io/instance: app-%d
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: app
+          image: "nginx:%s"
+          ports:
+            - name: http
+              containerPort: 80
+              protocol: TCP
+            - name: metrics
+              containerPort: 9090
+              protocol: TCP
+          env:
+            - name: LOG_LEVEL
+              value: "info"
+`, i, i, tag)
+		if every > 0 && i%every == 0 {
+			sb.WriteString("            - name: FEATURE_FLAG\n              value: \"true\"\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	cliOnce   sync.Once
+	cliBinary string
+	cliErr    error
+)
+
+// buildCLI builds the lemuria command once for all tests
+func buildCLI(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Skipping CLI tests in short mode")
+	}
+	cliOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "lemuria-cli")
+		if err != nil {
+			cliErr = err
+			return
+		}
+		cliBinary = filepath.Join(dir, "lemuria")
+		out, err := exec.Command("go", "build", "-o", cliBinary, "../cmd/lemuria").CombinedOutput()
+		if err != nil {
+			cliErr = errors.New(string(out))
+		}
+	})
+	require.NoError(t, cliErr)
+	return cliBinary
+}
+
+// runCLI runs the lemuria command and returns its stdout, stderr and exit code
+func runCLI(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(buildCLI(t), args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else {
+		require.NoError(t, err)
+	}
+	return stdout.String(), stderr.String(), code
+}
+
+func TestCLI_Render(t *testing.T) {
+	chartPath := filepath.Join(getTestDataDir(t), "valid-chart")
+
+	stdout, stderr, code := runCLI(t, "render", chartPath, "-f", filepath.Join(chartPath, "values-dev.yaml"),
+		"--set", "replicaCount=5", "--release-name", "cli", "-n", "staging")
+	require.Equal(t, 0, code, stderr)
+	assert.Empty(t, stderr)
+	assert.Contains(t, stdout, "kind: Deployment")
+	assert.Contains(t, stdout, "replicas: 5")
+	assert.Contains(t, stdout, "name: cli-test-app")
+	assert.Contains(t, stdout, "Hello from development")
+}
+
+func TestCLI_RenderOutputDir(t *testing.T) {
+	chartPath := filepath.Join(getTestDataDir(t), "valid-chart")
+	outputDir := t.TempDir()
+
+	stdout, stderr, code := runCLI(t, "render", chartPath, "-o", outputDir)
+	require.Equal(t, 0, code, stderr)
+	assert.Empty(t, stdout)
+
+	deployment, err := os.ReadFile(filepath.Join(outputDir, "test-app", "templates", "deployment.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(deployment), "kind: Deployment")
+	notes, err := os.ReadFile(filepath.Join(outputDir, "NOTES.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(notes), "ClusterIP")
+}
+
+func TestCLI_DiffValues(t *testing.T) {
+	chartPath := filepath.Join(getTestDataDir(t), "valid-chart")
+
+	stdout, stderr, code := runCLI(t, "diff", chartPath,
+		"--old-values", filepath.Join(chartPath, "values-dev.yaml"),
+		"--new-values", filepath.Join(chartPath, "values-prod.yaml"))
+	assert.Equal(t, 1, code, stderr)
+	assert.Empty(t, stderr)
+	assert.Contains(t, stdout, "--- old/Service/release-name-test-app")
+	assert.Contains(t, stdout, "-  type: NodePort")
+	assert.Contains(t, stdout, "+  type: LoadBalancer")
+
+	stdout, stderr, code = runCLI(t, "diff", chartPath, chartPath)
+	assert.Equal(t, 0, code, stderr)
+	assert.Empty(t, stdout)
+}
+
+func TestCLI_DiffKubeVersions(t *testing.T) {
+	chartPath := filepath.Join(getTestDataDir(t), "capabilities-chart")
+
+	stdout, stderr, code := runCLI(t, "diff", chartPath,
+		"--old-kube-version", "1.27", "--new-kube-version", "1.30",
+		"--api-versions", "monitoring.coreos.com/v1")
+	assert.Equal(t, 1, code, stderr)
+	assert.Contains(t, stdout, `-    kubernetes-version: "v1.27.0"`)
+	assert.Contains(t, stdout, `+    kubernetes-version: "v1.30.0"`)
+	assert.Contains(t, stdout, "+      initContainers:")
+	assert.NotContains(t, stdout, "ServiceMonitor")
+}
+
+func TestCLI_DiffManifestFiles(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.yaml")
+	newFile := filepath.Join(dir, "new.yaml")
+	require.NoError(t, os.WriteFile(oldFile, []byte("kind: Pod\nmetadata:\n  name: p\n  labels:\n    app: a\n"), 0o644))
+	require.NoError(t, os.WriteFile(newFile, []byte("kind: Pod\nmetadata:\n  name: p\n  labels:\n    app: b\n"), 0o644))
+
+	stdout, _, code := runCLI(t, "diff", oldFile, newFile, "-o", "json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, `"differences": true`)
+
+	policyFile := filepath.Join(dir, "policy.yaml")
+	require.NoError(t, os.WriteFile(policyFile, []byte("default: error\nrules:\n  - severity: none\n    paths: [metadata.labels]\n"), 0o644))
+	_, stderr, code := runCLI(t, "diff", oldFile, newFile, "--policy", policyFile)
+	assert.Equal(t, 0, code, stderr)
+
+	require.NoError(t, os.WriteFile(policyFile, []byte("default: error\n"), 0o644))
+	_, stderr, code = runCLI(t, "diff", oldFile, newFile, "--policy", policyFile)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "error Pod/p: metadata.labels.app: a -> b")
+
+	require.NoError(t, os.WriteFile(policyFile, []byte("default: error\nexitCodes:\n  error: 3\n"), 0o644))
+	_, _, code = runCLI(t, "diff", oldFile, newFile, "--policy", policyFile)
+	assert.Equal(t, 3, code)
+
+	// The exit code of failures cannot be a policy exit code
+	require.NoError(t, os.WriteFile(policyFile, []byte("default: error\nexitCodes:\n  error: 2\n"), 0o644))
+	stdout, stderr, code = runCLI(t, "diff", oldFile, newFile, "--policy", policyFile)
+	assert.Equal(t, 2, code)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "exit code 2 of severity error is reserved for errors")
+}
+
+func TestCLI_Errors(t *testing.T) {
+	stdout, stderr, code := runCLI(t, "render", filepath.Join(getTestDataDir(t), "does-not-exist"))
+	assert.Equal(t, 2, code)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "chart not found")
+
+	_, stderr, code = runCLI(t, "diff", "a.yaml", "b.yaml", "--no-such-flag")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "unknown flag")
+
+	_, stderr, code = runCLI(t, "frobnicate")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "unknown command")
+
+	stdout, _, code = runCLI(t, "diff", "--help")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "--old-values")
+}
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// configMap builds a ConfigMap manifest holding value under key
+func configMap(key, value string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  %s: |\n", key)
+	for _, line := range strings.Split(strings.TrimSuffix(value, "\n"), "\n") {
+		sb.WriteString("    " + line + "\n")
+	}
+	return sb.String()
+}
+
+func embeddedChanges(t *testing.T, d *diff.Diff, key, old, new string) []diff.FieldChange {
+	t.Helper()
+	result, err := d.CompareManifests(configMap(key, old), configMap(key, new))
+	require.NoError(t, err)
+	return result.Changes()
+}
+
+func TestEmbedded_JSONByExtension(t *testing.T) {
+	changes := embeddedChanges(t, diff.New(), "config.json",
+		`{"cache": {"enabled": true, "ttl": 300}, "hosts": ["a", "b"]}`,
+		`{"cache": {"enabled": true, "ttl": 600}, "hosts": ["a", "b", "c"]}`)
+
+	require.Len(t, changes, 2)
+	assert.Equal(t, `data["config.json"].cache.ttl`, changes[0].Path)
+	assert.Equal(t, diff.Modified, changes[0].Change)
+	assert.Equal(t, float64(300), changes[0].OldValue)
+	assert.Equal(t, float64(600), changes[0].NewValue)
+	assert.Equal(t, diff.FormatJSON, changes[0].Embedded)
+	assert.Equal(t, `data["config.json"].hosts[2]: (added) c`, changes[1].String())
+}
+
+func TestEmbedded_YAMLBySniffing(t *testing.T) {
+	changes := embeddedChanges(t, diff.New(), "application",
+		"server:\n  port: 8080\nlogging:\n  level: info\n",
+		"server:\n  port: 8080\nlogging:\n  level: debug\n")
+
+	require.Len(t, changes, 1)
+	assert.Equal(t, "data.application.logging.level: info -> debug", changes[0].String())
+	assert.Equal(t, diff.FormatYAML, changes[0].Embedded)
+}
+
+func TestEmbedded_TOML(t *testing.T) {
+	changes := embeddedChanges(t, diff.New(), "settings.toml",
+		"title = \"app\"\n\n[database]\nport = 5432\nmax_connections = 10\n",
+		"title = \"app\"\n\n[database]\nport = 5432\nmax_connections = 50\n")
+
+	require.Len(t, changes, 1)
+	assert.Equal(t, `data["settings.toml"].database.max_connections: 10 -> 50`, changes[0].String())
+	assert.Equal(t, diff.FormatTOML, changes[0].Embedded)
+}
+
+func TestEmbedded_Properties(t *testing.T) {
+	old := "# server settings\nserver.port=8080\nserver.host = localhost\ngreeting=hello \\\n  world\n"
+	new := "# server settings\nserver.port=9090\nserver.host = localhost\ngreeting=hello \\\n  there\n"
+
+	for _, key := range []string{"app.properties", "app-config"} {
+		changes := embeddedChanges(t, diff.New(), key, old, new)
+		require.Len(t, changes, 2, key)
+		assert.Equal(t, diff.FormatProperties, changes[0].Embedded)
+		assert.Equal(t, "hello world", changes[0].OldValue)
+		assert.Equal(t, "hello there", changes[0].NewValue)
+		assert.True(t, strings.HasSuffix(changes[1].Path, `["server.port"]`), changes[1].Path)
+		assert.Equal(t, "9090", changes[1].NewValue)
+	}
+}
+
+func TestEmbedded_TextLineDiff(t *testing.T) {
+	old := "server {\n    listen 80;\n    server_name example.com;\n    root /var/www;\n}\n"
+	new := "server {\n    listen 8080;\n    server_name example.com;\n    root /var/www;\n}\n"
+
+	changes := embeddedChanges(t, diff.New(), "nginx.conf", old, new)
+	require.Len(t, changes, 1)
+	change := changes[0]
+	assert.Equal(t, diff.FormatText, change.Embedded)
+	require.Len(t, change.Hunks, 1)
+	assert.Equal(t, `data["nginx.conf"]: (modified)
+  @@ -1,5 +1,5 @@
+   server {
+  -    listen 80;
+  +    listen 8080;
+       server_name example.com;
+       root /var/www;
+   }`, change.String())
+}
+
+func TestEmbedded_UnparsableFallsBackToValue(t *testing.T) {
+	changes := embeddedChanges(t, diff.New(), "config.json", `{"a": 1}`, `{"a": 1,}`)
+
+	require.Len(t, changes, 1)
+	assert.Equal(t, `data["config.json"]`, changes[0].Path)
+	assert.Empty(t, changes[0].Embedded)
+	assert.Equal(t, "{\"a\": 1}\n", changes[0].OldValue)
+}
+
+func TestEmbedded_FormattingOnlyChange(t *testing.T) {
+	old := configMap("config.json", `{"a": 1, "b": [1, 2]}`)
+	new := configMap("config.json", "{\n  \"b\": [1, 2],\n  \"a\": 1\n}")
+
+	result, err := diff.New(diff.WithSemanticComparison()).CompareManifests(old, new)
+	require.NoError(t, err)
+	assert.False(t, result.HasDifferences())
+
+	result, err = diff.New().CompareManifests(old, new)
+	require.NoError(t, err)
+	assert.True(t, result.HasDifferences(), "the text diff still shows the reformatted file")
+	assert.Empty(t, result.Changes())
+}
+
+func TestEmbedded_Rules(t *testing.T) {
+	old := "apiVersion: example.com/v1\nkind: Pipeline\nmetadata:\n  name: build\nspec:\n  config: '{\"steps\": 3}'\n"
+	new := "apiVersion: example.com/v1\nkind: Pipeline\nmetadata:\n  name: build\nspec:\n  config: '{\"steps\": 4}'\n"
+
+	result, err := diff.New().CompareManifests(old, new)
+	require.NoError(t, err)
+	assert.Equal(t, `spec.config: {"steps": 3} -> {"steps": 4}`, result.StructuralString(), "only ConfigMap data is embedded by default")
+
+	result, err = diff.New(diff.WithEmbeddedDocuments(diff.FieldRule{Kind: "Pipeline", Paths: []string{"spec.config"}})).CompareManifests(old, new)
+	require.NoError(t, err)
+	assert.Equal(t, "spec.config.steps: 3 -> 4", result.StructuralString())
+
+	changes := embeddedChanges(t, diff.New(diff.WithoutEmbeddedDocuments()), "config.json", `{"a": 1}`, `{"a": 2}`)
+	require.Len(t, changes, 1)
+	assert.Equal(t, `data["config.json"]`, changes[0].Path)
+
+	_, err = diff.New(diff.WithEmbeddedDocuments(diff.FieldRule{Kind: "Pipeline"})).CompareManifests(old, new)
+	assert.Error(t, err)
+}
+
+func TestEmbedded_RootRule(t *testing.T) {
+	d := diff.New(diff.WithEmbeddedDocuments(diff.FieldRule{Paths: []string{"**"}}))
+
+	// A scalar document is matched at the root, which has no key
+	result, err := d.CompareManifests("hello\n", "world\n")
+	require.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+
+	result, err = d.CompareManifests("'{\"a\": 1}'\n", "'{\"a\": 2}'\n")
+	require.NoError(t, err)
+	assert.Equal(t, "a: 1 -> 2", result.StructuralString())
+
+	result, err = d.CompareManifests("config: '{\"a\": 1}'\n", "config: '{\"a\": 2}'\n")
+	require.NoError(t, err)
+	assert.Equal(t, "config.a: 1 -> 2", result.StructuralString())
+}
@@ -0,0 +1,371 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/mishkaexe/lemuria/pkg/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const formatOldManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations:
+    example.com/owner: team-a
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.20
+          args: ["--port", "8080"]
+          env:
+            - name: LOG_LEVEL
+              value: info
+            - name: REGION
+              value: eu-west-1
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  type: ClusterIP
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: legacy
+data:
+  a: "1"`
+
+const formatNewManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations:
+    example.com/owner: team-b
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.21
+          args: ["--verbose", "--port", "8080"]
+          env:
+            - name: FEATURE_FLAG
+              value: "true"
+            - name: LOG_LEVEL
+              value: debug
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  type: ClusterIP
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: web`
+
+func compareFormatManifests(t *testing.T) *diff.DiffResult {
+	t.Helper()
+	result, err := diff.New().CompareMultipleManifests(formatOldManifests, formatNewManifests)
+	require.NoError(t, err)
+	return result
+}
+
+func formatWith(t *testing.T, f diff.Formatter, result *diff.DiffResult) string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, f.Format(&buf, result))
+	return buf.String()
+}
+
+func TestFormatter_NewFormatter(t *testing.T) {
+	assert.Equal(t, []string{"html", "json", "json-patch", "markdown", "side-by-side", "terminal", "unified", "word-diff"}, diff.FormatterNames())
+	for _, name := range diff.FormatterNames() {
+		f, err := diff.NewFormatter(name)
+		assert.NoError(t, err)
+		assert.NotNil(t, f)
+	}
+
+	_, err := diff.NewFormatter("xml")
+	assert.Error(t, err)
+}
+
+func TestFormatter_Unified(t *testing.T) {
+	result := compareFormatManifests(t)
+	assert.Equal(t, result.String()+"\n", formatWith(t, diff.UnifiedFormatter{}, result))
+}
+
+func TestFormatter_JSON(t *testing.T) {
+	result := compareFormatManifests(t)
+	output := formatWith(t, diff.JSONFormatter{}, result)
+
+	var doc struct {
+		Differences bool `json:"differences"`
+		Stats       struct {
+			ResourcesAdded    int `json:"resourcesAdded"`
+			ResourcesRemoved  int `json:"resourcesRemoved"`
+			ResourcesModified int `json:"resourcesModified"`
+			LinesAdded        int `json:"linesAdded"`
+		} `json:"stats"`
+		Resources []struct {
+			Kind    string `json:"kind"`
+			Name    string `json:"name"`
+			Change  string `json:"change"`
+			Changes []struct {
+				Path     string      `json:"path"`
+				Change   string      `json:"change"`
+				OldValue interface{} `json:"oldValue"`
+				NewValue interface{} `json:"newValue"`
+			} `json:"changes"`
+			Hunks []struct {
+				Lines []struct {
+					Op   string `json:"op"`
+					Text string `json:"text"`
+				} `json:"lines"`
+			} `json:"hunks"`
+		} `json:"resources"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(output), &doc))
+
+	assert.True(t, doc.Differences)
+	assert.Equal(t, 1, doc.Stats.ResourcesAdded)
+	assert.Equal(t, 1, doc.Stats.ResourcesRemoved)
+	assert.Equal(t, 1, doc.Stats.ResourcesModified)
+	assert.Equal(t, result.Stats().LinesAdded, doc.Stats.LinesAdded)
+
+	require.Len(t, doc.Resources, 4)
+	deployment := doc.Resources[0]
+	assert.Equal(t, "Deployment", deployment.Kind)
+	assert.Equal(t, "modified", deployment.Change)
+	assert.Contains(t, deployment.Changes, struct {
+		Path     string      `json:"path"`
+		Change   string      `json:"change"`
+		OldValue interface{} `json:"oldValue"`
+		NewValue interface{} `json:"newValue"`
+	}{Path: "spec.replicas", Change: "modified", OldValue: float64(2), NewValue: float64(3)})
+	require.NotEmpty(t, deployment.Hunks)
+	assert.Contains(t, deployment.Hunks[0].Lines, struct {
+		Op   string `json:"op"`
+		Text string `json:"text"`
+	}{Op: "removed", Text: "  replicas: 2"})
+}
+
+func TestFormatter_JSONPatch(t *testing.T) {
+	result := compareFormatManifests(t)
+	output := formatWith(t, diff.JSONPatchFormatter{}, result)
+
+	var entries []struct {
+		Resource struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"resource"`
+		Change string          `json:"change"`
+		Patch  json.RawMessage `json:"patch"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(output), &entries))
+	require.Len(t, entries, 3, "unchanged resources have no entry")
+
+	assert.Equal(t, "Deployment", entries[0].Resource.Kind)
+	assert.Equal(t, "modified", entries[0].Change)
+	assert.Equal(t, "ConfigMap", entries[1].Resource.Kind)
+	assert.Equal(t, "removed", entries[1].Change)
+	assert.JSONEq(t, `[{"op":"remove","path":""}]`, string(entries[1].Patch), "removed resources remove the whole document")
+	assert.Equal(t, "ServiceAccount", entries[2].Resource.Kind)
+	assert.Equal(t, "added", entries[2].Change)
+
+	// Applying the patch to the old Deployment yields the new one
+	oldDeployment := yamlToJSON(t, strings.Split(formatOldManifests, "---")[0])
+	newDeployment := yamlToJSON(t, strings.Split(formatNewManifests, "---")[0])
+
+	patch, err := jsonpatch.DecodePatch(entries[0].Patch)
+	require.NoError(t, err)
+	patched, err := patch.Apply(oldDeployment)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(newDeployment), string(patched))
+	assert.Contains(t, string(entries[0].Patch), `"path":"/metadata/annotations/example.com~1owner"`)
+}
+
+func TestFormatter_Markdown(t *testing.T) {
+	result := compareFormatManifests(t)
+	output := formatWith(t, diff.MarkdownFormatter{Title: "Render diff for web"}, result)
+
+	assert.True(t, strings.HasPrefix(output, "### Render diff for web\n"))
+	assert.Contains(t, output, "1 added, 1 removed, 1 modified, 1 unchanged")
+	assert.Contains(t, output, "| `Deployment/web` | modified | +")
+	assert.Contains(t, output, "<details>\n<summary><code>ServiceAccount/web</code> added (+4 -0)</summary>")
+	assert.Contains(t, output, "```diff\n--- Deployment/web\n+++ Deployment/web\n")
+	assert.NotContains(t, output, "Service/web</code>")
+
+	empty, err := diff.New().CompareMultipleManifests(formatOldManifests, formatOldManifests)
+	require.NoError(t, err)
+	assert.Contains(t, formatWith(t, diff.MarkdownFormatter{}, empty), "No differences.")
+}
+
+func TestFormatter_HTML(t *testing.T) {
+	result := compareFormatManifests(t)
+	output := formatWith(t, diff.HTMLFormatter{}, result)
+
+	assert.True(t, strings.HasPrefix(output, "<!DOCTYPE html>"))
+	assert.Contains(t, output, "<title>Manifest diff</title>")
+	assert.Contains(t, output, `<td class="num">8</td><td class="del">  replicas: 2</td><td class="num">8</td><td class="ins">  replicas: 3</td>`)
+	assert.Contains(t, output, "ServiceAccount/web")
+	assert.NotContains(t, output, "<link", "the report must be self-contained")
+
+	escaped, err := diff.New().CompareStrings("a: <b>", "a: <i>")
+	require.NoError(t, err)
+	html := formatWith(t, diff.HTMLFormatter{}, escaped)
+	assert.Contains(t, html, "a: &lt;b&gt;")
+	assert.NotContains(t, html, "a: <b>")
+}
+
+func TestFormatter_TerminalPlain(t *testing.T) {
+	result, err := diff.New(diff.WithLabels("a.yaml", "b.yaml")).CompareStrings("image: nginx:1.20\nreplicas: 2\n", "image: nginx:1.21\nreplicas: 2\n")
+	require.NoError(t, err)
+
+	output := formatWith(t, diff.TerminalFormatter{}, result)
+	assert.Equal(t, result.String()+"\n", output)
+	assert.NotContains(t, output, "\x1b[")
+}
+
+func TestFormatter_TerminalColor(t *testing.T) {
+	result, err := diff.New(diff.WithLabels("a.yaml", "b.yaml")).CompareStrings("image: nginx:1.20\nreplicas: 2\n", "image: nginx:1.21\nreplicas: 2\n")
+	require.NoError(t, err)
+
+	output := formatWith(t, diff.TerminalFormatter{Color: true}, result)
+	assert.Contains(t, output, "\x1b[1m--- a.yaml\x1b[0m\n")
+	assert.Contains(t, output, "\x1b[36m@@ -1,2 +1,2 @@\x1b[0m\n")
+	// Only the changed character is highlighted
+	assert.Contains(t, output, "\x1b[31m-image: nginx:1.2\x1b[7m0\x1b[27m\x1b[0m\n")
+	assert.Contains(t, output, "\x1b[32m+image: nginx:1.2\x1b[7m1\x1b[27m\x1b[0m\n")
+	assert.Contains(t, output, "\n replicas: 2\n")
+}
+
+func TestFormatter_TerminalSideBySide(t *testing.T) {
+	result := compareFormatManifests(t)
+	output := formatWith(t, diff.TerminalFormatter{SideBySide: true, Width: 60}, result)
+
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	for _, line := range lines {
+		assert.LessOrEqual(t, utf8.RuneCountInString(line), 60, line)
+	}
+	assert.Equal(t, "Deployment/web (modified)", lines[0])
+	assert.Contains(t, lines, " 8 -   replicas: 2           │  8 +   replicas: 3")
+	assert.Contains(t, lines, "14 -           args: [\"--po… │ 14 +           args: [\"--ve…")
+	assert.Contains(t, lines, "                             │ 16 +             - name: FE…")
+	assert.Contains(t, lines, "18 -             - name: RE… │")
+	assert.Contains(t, output, "ServiceAccount/web (added)")
+	assert.NotContains(t, output, "Service/web")
+}
+
+func TestFormatter_TerminalIntraLine(t *testing.T) {
+	old := "args: --port=8080 --verbose --log-format=json"
+	new := "args: --port=9090 --verbose --log-format=text"
+
+	result, err := diff.New(diff.WithIntraLineDiff(diff.WordGranularity)).CompareStrings(old, new)
+	require.NoError(t, err)
+	output := formatWith(t, diff.TerminalFormatter{Color: true}, result)
+	assert.Contains(t, output, "\x1b[31m-args: --port=\x1b[7m8080\x1b[27m --verbose --log-format=\x1b[7mjson\x1b[27m\x1b[0m\n")
+
+	output = formatWith(t, diff.TerminalFormatter{Color: true, SideBySide: true, Width: 120}, result)
+	assert.Contains(t, output, "\x1b[32margs: --port=\x1b[7m9090\x1b[27m --verbose --log-format=\x1b[7mtext\x1b[27m\x1b[0m\n")
+}
+
+func TestFormatter_WordDiff(t *testing.T) {
+	old := "name: web\nimage: nginx:1.20\nport: 80\nlegacy: true"
+	new := "name: web\nimage: nginx:1.21\nport: 8080\nreplicas: 3\nextra: yes"
+
+	result, err := diff.New(diff.WithLabels("a", "b")).CompareStrings(old, new)
+	require.NoError(t, err)
+	assert.Equal(t, `--- a
++++ b
+@@ -1,4 +1,5 @@
+name: web
+image: nginx:1.[-20-]{+21+}
+port: [-80-]{+8080+}
+[-legacy-]{+replicas+}: [-true-]{+3+}
+{+extra: yes+}
+`, formatWith(t, diff.WordDiffFormatter{}, result))
+
+	chars, err := diff.New(diff.WithIntraLineDiff(diff.CharGranularity)).CompareStrings("port: 80", "port: 8080")
+	require.NoError(t, err)
+	assert.Equal(t, "@@ -1 +1 @@\nport: 80{+80+}\n", formatWith(t, diff.WordDiffFormatter{}, chars))
+}
+
+func TestFormatter_JSONSegments(t *testing.T) {
+	result, err := diff.New(diff.WithIntraLineDiff(diff.WordGranularity)).CompareStrings("image: nginx:1.20", "image: nginx:1.21")
+	require.NoError(t, err)
+
+	output := formatWith(t, diff.JSONFormatter{}, result)
+	assert.Contains(t, output, `"segments":[{"op":"unchanged","text":"image: nginx:1."},{"op":"removed","text":"20"}]`)
+	assert.Contains(t, output, `"segments":[{"op":"unchanged","text":"image: nginx:1."},{"op":"added","text":"21"}]`)
+}
+
+func TestFormatter_TerminalDetection(t *testing.T) {
+	t.Setenv("COLUMNS", "132")
+	var buf bytes.Buffer
+	f := diff.NewTerminalFormatter(&buf, true)
+	assert.False(t, f.Color, "a buffer is not a terminal")
+	assert.True(t, f.SideBySide)
+	assert.Equal(t, 132, f.Width)
+
+	t.Setenv("NO_COLOR", "1")
+	t.Setenv("COLUMNS", "")
+	f = diff.NewTerminalFormatter(os.Stdout, false)
+	assert.False(t, f.Color)
+	assert.Greater(t, f.Width, 0)
+}
+
+func TestFormatter_Renamed(t *testing.T) {
+	old := "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: web\n  labels:\n    app: web\n    tier: frontend\n    team: payments"
+	new := strings.Replace(old, "name: web", "name: web-v2", 1)
+	result, err := diff.New().CompareMultipleManifests(old, new)
+	require.NoError(t, err)
+
+	markdown := formatWith(t, diff.MarkdownFormatter{}, result)
+	assert.Contains(t, markdown, "0 added, 0 removed, 0 modified, 1 renamed, 0 unchanged")
+	assert.Contains(t, markdown, "| `ServiceAccount/web-v2` | renamed from ServiceAccount/web | +1 -1 |")
+
+	var doc struct {
+		Resources []struct {
+			Name   string `json:"name"`
+			Change string `json:"change"`
+			From   struct {
+				Name string `json:"name"`
+			} `json:"from"`
+		} `json:"resources"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(formatWith(t, diff.JSONFormatter{}, result)), &doc))
+	require.Len(t, doc.Resources, 1)
+	assert.Equal(t, "web-v2", doc.Resources[0].Name)
+	assert.Equal(t, "renamed", doc.Resources[0].Change)
+	assert.Equal(t, "web", doc.Resources[0].From.Name)
+
+	terminal := formatWith(t, diff.TerminalFormatter{SideBySide: true}, result)
+	assert.True(t, strings.HasPrefix(terminal, "ServiceAccount/web-v2 (renamed from ServiceAccount/web)\n"))
+}
+
+func yamlToJSON(t *testing.T, doc string) []byte {
+	t.Helper()
+	var v interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(doc), &v))
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func compareNormalized(t *testing.T, d *diff.Diff, old, new string) *diff.DiffResult {
+	t.Helper()
+	result, err := d.CompareManifests(old, new)
+	require.NoError(t, err)
+	return result
+}
+
+func TestNormalize_KeyOrderAndQuoting(t *testing.T) {
+	old := `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: "80"
+      name: 'http'
+`
+	new := `kind: Service
+apiVersion: v1
+metadata:
+  name: web
+spec:
+  ports:
+    - name: http
+      port: 80
+`
+
+	result := compareNormalized(t, diff.New(), old, new)
+	assert.True(t, result.HasDifferences())
+
+	result = compareNormalized(t, diff.New(diff.WithNormalizers(diff.DefaultNormalizers...)), old, new)
+	assert.False(t, result.HasDifferences())
+	assert.Empty(t, result.String())
+}
+
+func TestNormalize_NonCanonicalStringsStay(t *testing.T) {
+	d := diff.New(diff.WithNormalizers(diff.CanonicalizeScalars))
+
+	result := compareNormalized(t, d,
+		"kind: ConfigMap\nmetadata:\n  name: c\ndata:\n  version: \"1.20\"\n",
+		"kind: ConfigMap\nmetadata:\n  name: c\ndata:\n  version: 1.2\n")
+	require.Len(t, result.Changes(), 1)
+	assert.Equal(t, "1.20", result.Changes()[0].OldValue)
+
+	result = compareNormalized(t, d,
+		"kind: ConfigMap\nmetadata:\n  name: c\ndata:\n  ratio: 1.0\n  enabled: True\n",
+		"kind: ConfigMap\nmetadata:\n  name: c\ndata:\n  ratio: 1\n  enabled: true\n")
+	assert.False(t, result.HasDifferences())
+}
+
+func TestNormalize_DropEmpty(t *testing.T) {
+	d := diff.New(diff.WithNormalizers(diff.DropEmpty))
+
+	result := compareNormalized(t, d,
+		"kind: Pod\nmetadata:\n  name: p\n  labels: {}\nspec:\n  volumes: []\n  nodeSelector:\n",
+		"kind: Pod\nmetadata:\n  name: p\nspec: {}\n")
+	assert.False(t, result.HasDifferences())
+}
+
+func TestNormalize_KubernetesDefaults(t *testing.T) {
+	old := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.27
+          ports:
+            - containerPort: 80
+`
+	new := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      restartPolicy: Always
+      containers:
+        - name: web
+          image: nginx:1.27
+          imagePullPolicy: IfNotPresent
+          ports:
+            - containerPort: 80
+              protocol: TCP
+`
+
+	d := diff.New(diff.WithNormalizers(append([]diff.Normalizer{diff.KubernetesDefaults}, diff.DefaultNormalizers...)...))
+	result := compareNormalized(t, d, old, new)
+	assert.False(t, result.HasDifferences(), result.String())
+
+	// A value other than the default is still reported
+	result = compareNormalized(t, d, old, strings.Replace(new, "IfNotPresent", "Always", 1))
+	require.Len(t, result.Changes(), 1)
+	assert.Equal(t, "spec.template.spec.containers[name=web].imagePullPolicy: IfNotPresent -> Always", result.Changes()[0].String())
+}
+
+func TestNormalize_ImagePullPolicyFromTag(t *testing.T) {
+	for image, policy := range map[string]string{
+		"nginx":                         "Always",
+		"nginx:latest":                  "Always",
+		"registry:5000/team/app":        "Always",
+		"registry:5000/team/app:v2":     "IfNotPresent",
+		"nginx@sha256:0123456789abcdef": "IfNotPresent",
+	} {
+		var node yaml.Node
+		require.NoError(t, yaml.Unmarshal([]byte("spec:\n  containers:\n    - name: c\n      image: "+image+"\n"), &node))
+		id := diff.ResourceID{Kind: "Pod", Name: "p"}
+		assert.True(t, diff.KubernetesDefaults.Normalize(id, node.Content[0]))
+
+		var pod struct {
+			Spec struct {
+				Containers []struct {
+					ImagePullPolicy string `yaml:"imagePullPolicy"`
+				} `yaml:"containers"`
+			} `yaml:"spec"`
+		}
+		require.NoError(t, node.Decode(&pod))
+		assert.Equal(t, policy, pod.Spec.Containers[0].ImagePullPolicy, image)
+	}
+}
+
+func TestNormalize_ServiceDefaults(t *testing.T) {
+	d := diff.New(diff.WithNormalizers(diff.KubernetesDefaults, diff.SortKeys))
+
+	result := compareNormalized(t, d,
+		"kind: Service\nmetadata:\n  name: web\nspec:\n  ports:\n    - port: 80\n",
+		"kind: Service\nmetadata:\n  name: web\nspec:\n  type: ClusterIP\n  ports:\n    - port: 80\n      targetPort: 80\n      protocol: TCP\n")
+	assert.False(t, result.HasDifferences(), result.String())
+}
+
+func TestNormalize_DefaultsBeforeCanonicalScalars(t *testing.T) {
+	// The order documented on WithNormalizers
+	d := diff.New(diff.WithNormalizers(append([]diff.Normalizer{diff.KubernetesDefaults}, diff.DefaultNormalizers...)...))
+
+	result := compareNormalized(t, d,
+		"kind: Service\nmetadata:\n  name: web\nspec:\n  ports:\n    - port: \"80\"\n",
+		"kind: Service\nmetadata:\n  name: web\nspec:\n  ports:\n    - port: 80\n")
+	assert.False(t, result.HasDifferences(), result.String())
+
+	result = compareNormalized(t, d,
+		"kind: Service\nmetadata:\n  name: web\nspec:\n  ports:\n    - port: '80'\n",
+		"kind: Service\nmetadata:\n  name: web\nspec:\n  ports:\n    - port: 80\n      targetPort: 80\n      protocol: TCP\n")
+	assert.False(t, result.HasDifferences(), result.String())
+}
@@ -0,0 +1,158 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const policyOldManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    version: "1"
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.26
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: coredns
+  namespace: kube-system
+data:
+  zone: cluster.local
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: legacy
+spec:
+  type: ClusterIP
+`
+
+const policyNewManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    version: "2"
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.27
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: coredns
+  namespace: kube-system
+data:
+  zone: cluster.internal
+`
+
+const policyFile = `default: info
+exitCodes:
+  error: 3
+rules:
+  - severity: none
+    paths: ["metadata.labels"]
+  - severity: error
+    kind: Deployment
+    paths: ["spec.template.spec.containers[*].image"]
+  - severity: warning
+    changes: [removed]
+  - severity: error
+    namespace: kube-system
+`
+
+func loadTestPolicy(t *testing.T, content string) *diff.Policy {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	policy, err := diff.LoadPolicy(file)
+	require.NoError(t, err)
+	return policy
+}
+
+func TestPolicy_Classify(t *testing.T) {
+	policy := loadTestPolicy(t, policyFile)
+	assert.Equal(t, diff.SeverityInfo, policy.Default)
+
+	result, err := diff.New().CompareMultipleManifests(policyOldManifests, policyNewManifests)
+	require.NoError(t, err)
+
+	classified, err := policy.Classify(result)
+	require.NoError(t, err)
+
+	require.Len(t, classified.Violations, 3)
+	assert.Equal(t, "error Deployment/web: spec.template.spec.containers[name=web].image: nginx:1.26 -> nginx:1.27", classified.Violations[0].String())
+	assert.Equal(t, 1, classified.Violations[0].Rule)
+	assert.Equal(t, diff.SeverityError, classified.Violations[1].Severity)
+	assert.Equal(t, "kube-system/ConfigMap/coredns", classified.Violations[1].Resource.String())
+	assert.Equal(t, diff.SeverityWarning, classified.Violations[2].Severity)
+	assert.Equal(t, diff.Removed, classified.Violations[2].ResourceChange)
+
+	assert.Equal(t, diff.SeverityError, classified.Severity)
+	assert.Equal(t, 3, classified.ExitCode())
+}
+
+func TestPolicy_IgnoredChangesPass(t *testing.T) {
+	policy := &diff.Policy{
+		Default: diff.SeverityWarning,
+		Rules: []diff.PolicyRule{
+			{Severity: diff.SeverityNone, Paths: []string{"**.labels"}},
+		},
+	}
+
+	result, err := diff.New().CompareMultipleManifests(
+		"kind: Pod\nmetadata:\n  name: p\n  labels:\n    app: a\n",
+		"kind: Pod\nmetadata:\n  name: p\n  labels:\n    app: b\n")
+	require.NoError(t, err)
+	require.True(t, result.HasDifferences())
+
+	classified, err := policy.Classify(result)
+	require.NoError(t, err)
+	assert.Empty(t, classified.Violations)
+	assert.Equal(t, diff.SeverityNone, classified.Severity)
+	assert.Equal(t, 0, classified.ExitCode())
+}
+
+func TestPolicy_DefaultExitCodes(t *testing.T) {
+	policy := &diff.Policy{}
+	assert.Equal(t, 0, policy.ExitCode(diff.SeverityWarning))
+	assert.Equal(t, 1, policy.ExitCode(diff.SeverityError))
+
+	severity, err := diff.ParseSeverity("Warning")
+	require.NoError(t, err)
+	assert.Equal(t, diff.SeverityWarning, severity)
+	_, err = diff.ParseSeverity("fatal")
+	assert.Error(t, err)
+}
+
+func TestPolicy_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"severity": "rules:\n  - severity: fatal\n",
+		"change":   "rules:\n  - severity: error\n    changes: [deleted]\n",
+		"path":     "rules:\n  - severity: error\n    paths: ['metadata.labels[\"unterminated']\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "policy.yaml")
+			require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+			_, err := diff.LoadPolicy(file)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const noisyOldManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    helm.sh/chart: web-1.0.0
+spec:
+  replicas: 2
+  template:
+    metadata:
+      annotations:
+        checksum/config: 1a2b3c
+        checksum/secret: 4d5e6f
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web-generated
+  labels:
+    helm.sh/chart: web-1.0.0
+data:
+  password: c2VjcmV0MQ==`
+
+const noisyNewManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    helm.sh/chart: web-1.1.0
+spec:
+  replicas: 2
+  template:
+    metadata:
+      annotations:
+        checksum/config: 7a8b9c
+        checksum/secret: 0d1e2f
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web-generated
+  labels:
+    helm.sh/chart: web-1.1.0
+data:
+  password: c2VjcmV0Mg==`
+
+func TestIgnoreRules_RemoveNoisyFields(t *testing.T) {
+	result, err := diff.New().CompareMultipleManifests(noisyOldManifests, noisyNewManifests)
+	require.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+
+	d := diff.New(diff.WithIgnoreRules(
+		diff.FieldRule{Paths: []string{
+			`metadata.labels["helm.sh/chart"]`,
+			`spec.template.metadata.annotations["checksum/*"]`,
+		}},
+		diff.FieldRule{Kind: "Secret", Name: "*-generated", Paths: []string{"data"}},
+	))
+	result, err = d.CompareMultipleManifests(noisyOldManifests, noisyNewManifests)
+	require.NoError(t, err)
+	assert.False(t, result.HasDifferences(), result.String())
+	for _, res := range result.Resources() {
+		assert.Equal(t, diff.Unchanged, res.Change, "%s should be unchanged", res.ID)
+	}
+}
+
+func TestIgnoreRules_ScopedToResource(t *testing.T) {
+	d := diff.New(diff.WithIgnoreRules(
+		diff.FieldRule{Kind: "Deployment", Paths: []string{`**.annotations["checksum/*"]`, `metadata.labels["helm.sh/*"]`}},
+	))
+
+	result, err := d.CompareMultipleManifests(noisyOldManifests, noisyNewManifests)
+	require.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+
+	changes := make(map[string]diff.ChangeType)
+	for _, res := range result.Resources() {
+		changes[res.ID.String()] = res.Change
+	}
+	assert.Equal(t, diff.Unchanged, changes["Deployment/web"])
+	assert.Equal(t, diff.Modified, changes["Secret/web-generated"])
+
+	output := result.String()
+	assert.NotContains(t, output, "checksum/config")
+	assert.Contains(t, output, "+    helm.sh/chart: web-1.1.0")
+}
+
+func TestIgnoreRules_ListElements(t *testing.T) {
+	oldManifest := `spec:
+  containers:
+    - name: web
+      image: nginx:1.20
+      env:
+        - name: RANDOM_TOKEN
+          value: abc
+    - name: sidecar
+      image: envoy:1.28`
+	newManifest := `spec:
+  containers:
+    - name: web
+      image: nginx:1.20
+      env:
+        - name: RANDOM_TOKEN
+          value: xyz
+    - name: sidecar
+      image: envoy:1.29`
+
+	d := diff.New(diff.WithIgnoreRules(diff.FieldRule{Paths: []string{"spec.containers[*].env[RANDOM_TOKEN]"}}))
+	result, err := d.CompareManifests(oldManifest, newManifest)
+	require.NoError(t, err)
+
+	require.Len(t, result.Changes(), 1)
+	assert.Equal(t, "spec.containers[name=sidecar].image: envoy:1.28 -> envoy:1.29", result.Changes()[0].String())
+	assert.NotContains(t, result.String(), "RANDOM_TOKEN")
+}
+
+func TestIgnoreRules_KeyedListByIndex(t *testing.T) {
+	oldManifest := `kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.20
+        - name: sidecar
+          image: envoy:1.28`
+	newManifest := strings.NewReplacer("1.20", "1.21", "1.28", "1.29").Replace(oldManifest)
+
+	// Containers are matched by name, but can still be selected by index
+	d := diff.New(diff.WithIgnoreRules(diff.FieldRule{Paths: []string{"spec.template.spec.containers[0].image"}}))
+	result, err := d.CompareManifests(oldManifest, newManifest)
+	require.NoError(t, err)
+	require.Len(t, result.Changes(), 1)
+	assert.Equal(t, "spec.template.spec.containers[name=sidecar].image: envoy:1.28 -> envoy:1.29", result.Changes()[0].String())
+
+	policy := diff.Policy{Rules: []diff.PolicyRule{{Severity: diff.SeverityError, Paths: []string{"spec.template.spec.containers[1].image"}}}}
+	result, err = diff.New().CompareMultipleManifests(oldManifest, newManifest)
+	require.NoError(t, err)
+	classified, err := policy.Classify(result)
+	require.NoError(t, err)
+	require.Len(t, classified.Violations, 1)
+	assert.Equal(t, "spec.template.spec.containers[name=sidecar].image", classified.Violations[0].Change.Path)
+}
+
+func TestIgnoreRules_MergeKeyPaths(t *testing.T) {
+	oldManifest := `kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 443
+      name: https
+    - port: 80
+      name: http`
+	newManifest := strings.NewReplacer("name: https", "name: tls", "name: http\n", "name: plain\n").Replace(oldManifest + "\n")
+
+	// A merge key value is told apart from an index by naming its field
+	result, err := diff.New().CompareManifests(oldManifest, newManifest)
+	require.NoError(t, err)
+	var paths []string
+	for _, change := range result.Changes() {
+		paths = append(paths, change.Path)
+	}
+	assert.Equal(t, []string{"spec.ports[port=443].name", "spec.ports[port=80].name"}, paths)
+
+	// The paths reported are the paths rules select, by key or by index
+	for _, path := range []string{"spec.ports[port=80].name", "spec.ports[80].name", "spec.ports[1].name"} {
+		d := diff.New(diff.WithIgnoreRules(diff.FieldRule{Paths: []string{path}}))
+		result, err := d.CompareManifests(oldManifest, newManifest)
+		require.NoError(t, err)
+		require.Len(t, result.Changes(), 1, path)
+		assert.Equal(t, "spec.ports[port=443].name", result.Changes()[0].Path, path)
+	}
+
+	// A field selector only matches elements keyed by that field
+	d := diff.New(diff.WithIgnoreRules(diff.FieldRule{Paths: []string{"spec.ports[name=*].name"}}))
+	result, err = d.CompareManifests(oldManifest, newManifest)
+	require.NoError(t, err)
+	assert.Len(t, result.Changes(), 2)
+}
+
+func TestLoadIgnoreRules(t *testing.T) {
+	dir := t.TempDir()
+	rulesFile := filepath.Join(dir, "ignore.yaml")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(`ignore:
+  - paths:
+      - metadata.labels["helm.sh/chart"]
+      - $.spec.template.metadata.annotations['checksum/*']
+  - kind: Secret
+    name: "*-generated"
+    paths: ["data.*"]
+`), 0o644))
+
+	rules, err := diff.LoadIgnoreRules(rulesFile)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "Secret", rules[1].Kind)
+
+	result, err := diff.New(diff.WithIgnoreRules(rules...)).CompareMultipleManifests(noisyOldManifests, noisyNewManifests)
+	require.NoError(t, err)
+	assert.False(t, result.HasDifferences(), result.String())
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		invalidFile := filepath.Join(dir, "invalid.yaml")
+		require.NoError(t, os.WriteFile(invalidFile, []byte("ignore:\n  - paths: ['metadata.labels[\"unterminated']\n"), 0o644))
+		_, err := diff.LoadIgnoreRules(invalidFile)
+		assert.Error(t, err)
+
+		_, err = diff.New(diff.WithIgnoreRules(diff.FieldRule{Paths: []string{"spec..replicas"}})).CompareManifests("a: 1", "a: 2")
+		assert.Error(t, err)
+
+		// JSONPath recursive descent is not mistaken for a top-level key
+		_, err = diff.New(diff.WithIgnoreRules(diff.FieldRule{Paths: []string{"$..image"}})).CompareManifests("a: 1", "a: 2")
+		assert.ErrorContains(t, err, `use "**"`)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := diff.LoadIgnoreRules(filepath.Join(dir, "missing.yaml"))
+		assert.Error(t, err)
+	})
+}
+
+func TestSecretMasking(t *testing.T) {
+	oldSecret := `apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+data:
+  username: YWRtaW4=
+  password: c2VjcmV0MQ==
+stringData:
+  token: plain-old-token`
+	newSecret := `apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+data:
+  username: YWRtaW4=
+  password: c2VjcmV0Mg==
+stringData:
+  token: plain-old-token`
+
+	result, err := diff.New().CompareMultipleManifests(oldSecret, newSecret)
+	require.NoError(t, err)
+	require.True(t, result.HasDifferences())
+
+	output := result.String()
+	for _, value := range []string{"YWRtaW4=", "c2VjcmV0MQ==", "c2VjcmV0Mg==", "plain-old-token"} {
+		assert.NotContains(t, output, value)
+		assert.NotContains(t, result.StructuralString(), value)
+	}
+	assert.Regexp(t, `-  password: <redacted:[0-9a-f]{16}>`, output)
+	assert.Regexp(t, `\+  password: <redacted:[0-9a-f]{16}>`, output)
+	assert.Regexp(t, `\n   username: <redacted:[0-9a-f]{16}>`, output, "unchanged values keep the same marker")
+
+	changes := result.Resources()[0].Result.Changes()
+	require.Len(t, changes, 1)
+	assert.True(t, changes[0].Masked)
+	assert.Equal(t, "data.password: (modified) <redacted>", changes[0].String())
+}
+
+func TestSecretMasking_Comments(t *testing.T) {
+	oldSecret := "kind: Secret\nmetadata:\n  name: db\ndata:\n  pw: aGVsbG8= # was aGVsbG8=\nstringData:\n  # rotated from aGVsbG8=\n  config: # was c2VjcmV0\n    user: admin\n"
+	newSecret := "kind: Secret\nmetadata:\n  name: db\ndata:\n  pw: d29ybGQ= # was aGVsbG8=\nstringData:\n  # rotated from aGVsbG8=\n  config: # was c2VjcmV0\n    user: root # was admin\n"
+
+	result, err := diff.New(diff.WithMaskRules(diff.FieldRule{Kind: "Secret", Paths: []string{"stringData.config"}})).CompareManifests(oldSecret, newSecret)
+	require.NoError(t, err)
+	output := result.String()
+	for _, value := range []string{"aGVsbG8=", "d29ybGQ=", "c2VjcmV0", "admin", "root"} {
+		assert.NotContains(t, output, value)
+	}
+	assert.Regexp(t, `\+  pw: <redacted:[0-9a-f]{16}>\n`, output)
+	assert.Regexp(t, `(?m)^\+  config: <redacted:[0-9a-f]{16}>$`, output)
+}
+
+func TestSecretMasking_Lists(t *testing.T) {
+	oldList := `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: settings
+  data:
+    mode: fast
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: db
+  data:
+    pw: c2VjcmV0
+  stringData:
+    token: plain-token
+`
+	newList := strings.ReplaceAll(strings.ReplaceAll(oldList, "c2VjcmV0", "bmV3"), "fast", "slow")
+
+	result, err := diff.New().CompareManifests(oldList, newList)
+	require.NoError(t, err)
+	output := result.String()
+	for _, value := range []string{"c2VjcmV0", "bmV3", "plain-token"} {
+		assert.NotContains(t, output, value)
+	}
+	assert.Regexp(t, `\+      pw: <redacted:[0-9a-f]{16}>`, output)
+	assert.Contains(t, output, "+      mode: slow", "other items are not masked")
+
+	// The items of a typed list have no kind of their own
+	oldSecrets := "apiVersion: v1\nkind: SecretList\nitems:\n- metadata:\n    name: db\n  data:\n    pw: c2VjcmV0\n"
+	newSecrets := strings.ReplaceAll(oldSecrets, "c2VjcmV0", "bmV3")
+	result, err = diff.New().CompareManifests(oldSecrets, newSecrets)
+	require.NoError(t, err)
+	assert.NotContains(t, result.String(), "c2VjcmV0")
+	assert.NotContains(t, result.String(), "bmV3")
+}
+
+func TestSecretMasking_InvalidYAML(t *testing.T) {
+	oldSecret := "kind: Secret\nmetadata:\n  name: db\ndata:\n  pw: YWJj\n"
+	// The tab indentation makes the new secret invalid YAML
+	newSecret := "kind: Secret\nmetadata:\n  name: db\ndata:\n\tpw: ZGVm\n"
+
+	// Masking cannot be applied to text, so invalid manifests are an error
+	result, err := diff.New().CompareManifests(oldSecret, newSecret)
+	require.Error(t, err)
+	assert.Nil(t, result)
+	assert.NotContains(t, err.Error(), "YWJj")
+	assert.NotContains(t, err.Error(), "ZGVm")
+
+	_, err = diff.New().CompareMultipleManifests(oldSecret, newSecret)
+	require.Error(t, err)
+
+	// Without masking they are still compared as text
+	result, err = diff.New(diff.WithoutSecretMasking()).CompareManifests(oldSecret, newSecret)
+	require.NoError(t, err)
+	assert.Contains(t, result.String(), "+\tpw: ZGVm")
+
+	// Invalid manifests of kinds that are not masked are compared as text
+	oldConfig := strings.ReplaceAll(oldSecret, "kind: Secret", "kind: ConfigMap")
+	newConfig := strings.ReplaceAll(newSecret, "kind: Secret", "kind: ConfigMap")
+	result, err = diff.New().CompareManifests(oldConfig, newConfig)
+	require.NoError(t, err)
+	assert.Contains(t, result.String(), "+\tpw: ZGVm")
+
+	// unless a mask rule covers every kind
+	_, err = diff.New(diff.WithMaskRules(diff.FieldRule{Paths: []string{"**.password"}})).CompareManifests(oldConfig, newConfig)
+	require.Error(t, err)
+
+	// Lists of Secrets are masked, so they are not compared as text either
+	_, err = diff.New().CompareManifests(strings.ReplaceAll(oldSecret, "kind: Secret", "kind: SecretList"), newConfig)
+	require.Error(t, err)
+}
+
+func TestSecretMasking_CustomRulesAndOptOut(t *testing.T) {
+	oldManifest := `apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: orders
+spec:
+  connection:
+    host: db.internal
+    password: hunter2`
+	newManifest := `apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: orders
+spec:
+  connection:
+    host: db.internal
+    password: hunter3`
+
+	d := diff.New(diff.WithMaskRules(diff.FieldRule{Kind: "Database", Paths: []string{"**.password"}}))
+	result, err := d.CompareManifests(oldManifest, newManifest)
+	require.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+	assert.NotContains(t, result.String(), "hunter")
+	assert.Contains(t, result.String(), "    host: db.internal")
+
+	secret := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  password: c2VjcmV0MQ=="
+	result, err = diff.New(diff.WithoutSecretMasking()).CompareManifests(secret, secret+"\n  username: YWRtaW4=")
+	require.NoError(t, err)
+	assert.Contains(t, result.String(), "+  username: YWRtaW4=")
+}
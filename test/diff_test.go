@@ -1,10 +1,17 @@
 package test
 
 import (
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/mishkaexe/lemuria/pkg/diff"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCompareStrings_IdenticalStrings(t *testing.T) {
@@ -149,7 +156,8 @@ spec:
 	output := result.String()
 	assert.Contains(t, output, "-          image: \"nginx:1.20\"")
 	assert.Contains(t, output, "+          image: \"nginx:1.21\"")
-	assert.Contains(t, output, " kind: Deployment")  // Context line
+	assert.Contains(t, output, "         - name: my-app")  // Context line
+	assert.NotContains(t, output, " kind: Deployment")  // Beyond the context radius
 }
 
 func TestCompareManifests_DeploymentReplicasAndEnvVars(t *testing.T) {
@@ -273,4 +281,879 @@ data:
 	assert.Contains(t, output, "+      targetPort: 8080")
 	assert.Contains(t, output, "+apiVersion: v1")  // New ConfigMap
 	assert.Contains(t, output, "+kind: ConfigMap")
-}
\ No newline at end of file
+}
+
+func TestCompareMultipleManifests_ReorderedResourcesUnchanged(t *testing.T) {
+	d := diff.New()
+
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2`
+	service := `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80`
+
+	result, err := d.CompareMultipleManifests(deployment+"\n---\n"+service, service+"\n---\n"+deployment)
+	assert.NoError(t, err)
+	assert.False(t, result.HasDifferences())
+	assert.Empty(t, result.String())
+
+	resources := result.Resources()
+	assert.Len(t, resources, 2)
+	for _, res := range resources {
+		assert.Equal(t, diff.Unchanged, res.Change, "%s should be unchanged", res.ID)
+	}
+}
+
+func TestCompareMultipleManifests_ResourceChanges(t *testing.T) {
+	d := diff.New()
+
+	oldManifests := `# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+spec:
+  replicas: 2
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: prod
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: legacy
+  namespace: prod`
+
+	newManifests := `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: prod
+---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+spec:
+  replicas: 3
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web
+  namespace: prod`
+
+	result, err := d.CompareMultipleManifests(oldManifests, newManifests)
+	assert.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+
+	changes := make(map[string]diff.ChangeType)
+	for _, res := range result.Resources() {
+		changes[res.ID.String()] = res.Change
+	}
+	assert.Equal(t, map[string]diff.ChangeType{
+		"prod/Deployment/web":   diff.Modified,
+		"prod/Service/web":      diff.Unchanged,
+		"prod/ConfigMap/legacy": diff.Removed,
+		"prod/Secret/web":       diff.Added,
+	}, changes)
+
+	output := result.String()
+	assert.Contains(t, output, "--- prod/Deployment/web")
+	assert.Contains(t, output, "+++ prod/Deployment/web")
+	assert.Contains(t, output, "+++ /dev/null")
+	assert.Contains(t, output, "+kind: Secret")
+	assert.NotContains(t, output, "Service")
+}
+
+func TestCompareMultipleManifests_InvalidYAML(t *testing.T) {
+	d := diff.New()
+	_, err := d.CompareMultipleManifests("kind: [unclosed", "kind: Service")
+	assert.Error(t, err)
+}
+
+func TestCompareStrings_RepeatedLinesMinimalDiff(t *testing.T) {
+	d := diff.New()
+	old := `ports:
+  - name: http
+    port: 80
+  - name: metrics
+    port: 9090`
+	new := `ports:
+  - name: grpc
+    port: 50051
+  - name: http
+    port: 80
+  - name: metrics
+    port: 9090`
+
+	result, err := d.CompareStrings(old, new)
+	assert.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+
+	added, removed := countEdits(result.String())
+	assert.Equal(t, 2, added, "only the new port entry should be added")
+	assert.Equal(t, 0, removed, "no existing lines should be removed")
+	assert.Contains(t, result.String(), "+  - name: grpc")
+	assert.Contains(t, result.String(), "+    port: 50051")
+}
+
+func TestCompareStrings_MinimalEditCount(t *testing.T) {
+	d := diff.New()
+	rng := rand.New(rand.NewSource(42))
+	alphabet := []string{"a", "b", "c", "- name: http", "  port: 80"}
+
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		return lines
+	}
+
+	for i := 0; i < 200; i++ {
+		oldLines, newLines := randomLines(), randomLines()
+		result, err := d.CompareStrings(joinLines(oldLines), joinLines(newLines))
+		assert.NoError(t, err)
+
+		added, removed := countEdits(result.String())
+		common := lcsLength(oldLines, newLines)
+		assert.Equal(t, len(newLines)-common, added, "case %d: additions should be minimal", i)
+		assert.Equal(t, len(oldLines)-common, removed, "case %d: deletions should be minimal", i)
+	}
+}
+
+// joinLines joins lines into text ending in a newline
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// countEdits counts added and removed lines in unified diff output
+func countEdits(output string) (added, removed int) {
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// lcsLength computes the longest common subsequence length by dynamic programming
+func lcsLength(a, b []string) int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+	return table[0][0]
+}
+
+func TestCompareStrings_UnifiedHunks(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 1; i <= 20; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("line%d", i))
+		newLines = append(newLines, fmt.Sprintf("line%d", i))
+	}
+	newLines[1] = "line2_modified"
+	newLines[17] = "line18_modified"
+
+	d := diff.New()
+	result, err := d.CompareStrings(strings.Join(oldLines, "\n"), strings.Join(newLines, "\n"))
+	assert.NoError(t, err)
+
+	expected := `@@ -1,5 +1,5 @@
+ line1
+-line2
++line2_modified
+ line3
+ line4
+ line5
+@@ -15,6 +15,6 @@
+ line15
+ line16
+ line17
+-line18
++line18_modified
+ line19
+ line20
+\ No newline at end of file`
+	assert.Equal(t, expected, result.String())
+}
+
+func TestCompareStrings_ContextLinesOption(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng"
+	new := "a\nb\nc\nD\ne\nf\ng"
+
+	result, err := diff.New(diff.WithContextLines(1)).CompareStrings(old, new)
+	assert.NoError(t, err)
+	assert.Equal(t, "@@ -3,3 +3,3 @@\n c\n-d\n+D\n e", result.String())
+
+	result, err = diff.New(diff.WithContextLines(0)).CompareStrings(old, "a\nb\nc\nd\nd2\ne\nf\ng")
+	assert.NoError(t, err)
+	assert.Equal(t, "@@ -4,0 +5 @@\n+d2", result.String())
+}
+
+func TestCompareStrings_LabelsApplyWithGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	var oldLines []string
+	for i := 1; i <= 30; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("key%d: value%d", i, i))
+	}
+	newLines := append([]string{"header: true"}, oldLines...)
+	newLines[15] = "key15: changed"
+	newLines = append(newLines[:25], newLines[26:]...)
+
+	old := strings.Join(oldLines, "\n") + "\n"
+	new := strings.Join(newLines, "\n") + "\n"
+
+	d := diff.New(diff.WithLabels("a/values.yaml", "b/values.yaml"))
+	result, err := d.CompareStrings(old, new)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(result.String(), "--- a/values.yaml\n+++ b/values.yaml\n@@ "))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "values.yaml"), []byte(old), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "change.patch"), []byte(result.String()+"\n"), 0o644))
+
+	cmd := exec.Command("git", "apply", "change.patch")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git apply failed: %s", out)
+
+	patched, err := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, new, string(patched))
+}
+
+func TestCompareStrings_NoNewlineAtEndOfFile(t *testing.T) {
+	d := diff.New()
+	result, err := d.CompareStrings("x\ny\n", "x\ny")
+	require.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+	assert.Equal(t, "@@ -1,2 +1,2 @@\n x\n-y\n+y\n\\ No newline at end of file", result.String())
+
+	result, err = d.CompareStrings("a\nb", "a\nB")
+	require.NoError(t, err)
+	assert.Equal(t, "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+B\n\\ No newline at end of file", result.String())
+	assert.Equal(t, []diff.Line{
+		{Op: ' ', Text: "a", OldNumber: 1, NewNumber: 1},
+		{Op: '-', Text: "b", OldNumber: 2, NoNewline: true},
+		{Op: '+', Text: "B", NewNumber: 2, NoNewline: true},
+	}, result.Hunks()[0].Lines)
+
+	// Documents of a manifest stream always end with a newline
+	result, err = d.CompareMultipleManifests("kind: A\nmetadata:\n  name: a\nx: 1", "kind: A\nmetadata:\n  name: a\nx: 2\n")
+	require.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+	assert.NotContains(t, result.String(), "No newline")
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	for _, tc := range []struct{ old, new string }{
+		{"x\ny\n", "x\ny"},
+		{"x\ny", "x\ny\n"},
+		{"x\ny", "x\nz"},
+		{"x\ny", "x\ny\nz"},
+		{"a\nb\nc\nd\ne\nf\ng\nh", "a\nB\nc\nd\ne\nf\ng\nh"},
+	} {
+		result, err := diff.New(diff.WithLabels("a/file", "b/file")).CompareStrings(tc.old, tc.new)
+		require.NoError(t, err)
+
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte(tc.old), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "change.patch"), []byte(result.String()+"\n"), 0o644))
+
+		cmd := exec.Command("git", "apply", "change.patch")
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "git apply failed for %q: %s", tc.new, out)
+
+		patched, err := os.ReadFile(filepath.Join(dir, "file"))
+		require.NoError(t, err)
+		assert.Equal(t, tc.new, string(patched))
+	}
+}
+
+func TestCompareManifests_RewrittenKeepNewline(t *testing.T) {
+	secret := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  pw: %s\n"
+	configMap := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  annotations:\n    checksum: %s\ndata:\n  y: %s\n"
+	ignore := diff.WithIgnoreRules(diff.FieldRule{Paths: []string{"metadata.annotations"}})
+
+	for name, tc := range map[string]struct {
+		d        *diff.Diff
+		old, new string
+	}{
+		"masked":     {diff.New(), fmt.Sprintf(secret, "YQ=="), fmt.Sprintf(secret, "Yg==")},
+		"ignored":    {diff.New(ignore), fmt.Sprintf(configMap, "1", "b"), fmt.Sprintf(configMap, "2", "c")},
+		"normalized": {diff.New(diff.WithNormalizers(diff.SortKeys)), fmt.Sprintf(configMap, "1", "b"), fmt.Sprintf(configMap, "1", "c")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := tc.d.CompareManifests(tc.old, tc.new)
+			require.NoError(t, err)
+			assert.True(t, result.HasDifferences())
+			assert.NotContains(t, result.String(), "No newline")
+
+			result, err = tc.d.CompareMultipleManifests(tc.old, tc.new)
+			require.NoError(t, err)
+			assert.NotContains(t, result.String(), "No newline")
+		})
+	}
+}
+
+func TestCompareMultipleManifests_ResourceLabels(t *testing.T) {
+	d := diff.New(diff.WithLabels("web-1.0.0", "web-1.1.0"))
+
+	result, err := d.CompareMultipleManifests(
+		"apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  type: ClusterIP",
+		"apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  type: NodePort\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web",
+	)
+	assert.NoError(t, err)
+
+	output := result.String()
+	assert.Contains(t, output, "--- web-1.0.0/Service/web\n+++ web-1.1.0/Service/web\n@@ -3,4 +3,4 @@")
+	assert.Contains(t, output, "--- /dev/null\n+++ web-1.1.0/ConfigMap/web\n@@ -0,0 +1,4 @@")
+}
+
+func TestCompareManifests_StructuralChanges(t *testing.T) {
+	d := diff.New()
+
+	oldManifest := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    helm.sh/chart: web-1.0.0
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: sidecar
+          image: envoy:1.28
+        - name: web
+          image: "nginx:1.20"`
+
+	newManifest := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    helm.sh/chart: web-1.1.0
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: "nginx:1.21"
+        - name: sidecar
+          image: envoy:1.28
+  strategy:
+    type: Recreate`
+
+	result, err := d.CompareManifests(oldManifest, newManifest)
+	assert.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+
+	var lines []string
+	for _, change := range result.Changes() {
+		lines = append(lines, change.String())
+	}
+	assert.Equal(t, []string{
+		`metadata.labels["helm.sh/chart"]: web-1.0.0 -> web-1.1.0`,
+		`spec.replicas: (removed) 2`,
+		`spec.strategy: (added) {"type":"Recreate"}`,
+		`spec.template.spec.containers[name=web].image: nginx:1.20 -> nginx:1.21`,
+	}, lines)
+
+	// The text diff is still available from the same result
+	assert.Contains(t, result.String(), "-  replicas: 2")
+	assert.Equal(t, strings.Join(lines, "\n"), result.StructuralString())
+}
+
+func TestCompareManifests_SemanticIgnoresFormatting(t *testing.T) {
+	oldManifest := `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  labels: {app: web, tier: "frontend"}
+spec:
+  type: ClusterIP
+  ports:
+  - port: 80`
+
+	newManifest := `kind: Service
+apiVersion: v1
+metadata:
+  labels:
+    tier: frontend
+    app: 'web'
+  name: web
+spec:
+  ports:
+    - port: 80
+  type: "ClusterIP"`
+
+	result, err := diff.New().CompareManifests(oldManifest, newManifest)
+	assert.NoError(t, err)
+	assert.True(t, result.HasDifferences(), "text comparison reports formatting changes")
+	assert.Empty(t, result.Changes())
+
+	result, err = diff.New(diff.WithSemanticComparison()).CompareManifests(oldManifest, newManifest)
+	assert.NoError(t, err)
+	assert.False(t, result.HasDifferences())
+	assert.Empty(t, result.String())
+
+	_, err = diff.New(diff.WithSemanticComparison()).CompareManifests(oldManifest, "kind: [unclosed")
+	assert.Error(t, err)
+}
+
+func TestCompareMultipleManifests_StructuralString(t *testing.T) {
+	d := diff.New(diff.WithSemanticComparison())
+
+	result, err := d.CompareMultipleManifests(
+		"apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  type: ClusterIP\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata: {a: '1'}",
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  a: \"1\"\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  type: NodePort",
+	)
+	assert.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+	assert.Equal(t, "Service/web (modified):\n  spec.type: ClusterIP -> NodePort", result.StructuralString())
+}
+
+func TestCompareManifests_MergeKeyListMatching(t *testing.T) {
+	d := diff.New()
+
+	oldManifest := `spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          args: ["--port", "8080"]
+          env:
+            - name: LOG_LEVEL
+              value: info
+            - name: REGION
+              value: eu-west-1
+          ports:
+            - containerPort: 8080
+            - containerPort: 9090
+          volumeMounts:
+            - mountPath: /etc/config
+              name: config`
+
+	newManifest := `spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          args: ["--verbose", "--port", "8080"]
+          env:
+            - name: FEATURE_FLAG
+              value: "true"
+            - name: LOG_LEVEL
+              value: info
+            - name: REGION
+              value: eu-west-1
+          ports:
+            - containerPort: 9090
+            - containerPort: 8080
+              name: http
+          volumeMounts:
+            - mountPath: /etc/config
+              name: settings`
+
+	result, err := d.CompareManifests(oldManifest, newManifest)
+	assert.NoError(t, err)
+
+	var lines []string
+	for _, change := range result.Changes() {
+		lines = append(lines, change.String())
+	}
+	assert.Equal(t, []string{
+		`spec.template.spec.containers[name=web].args[0]: (added) --verbose`,
+		`spec.template.spec.containers[name=web].env[name=FEATURE_FLAG]: (added) {"name":"FEATURE_FLAG","value":"true"}`,
+		`spec.template.spec.containers[name=web].ports[containerPort=8080].name: (added) http`,
+		`spec.template.spec.containers[name=web].volumeMounts[mountPath=/etc/config].name: config -> settings`,
+	}, lines)
+}
+
+func TestCompareManifests_CustomMergeKeys(t *testing.T) {
+	oldManifest := `apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+spec:
+  endpoints:
+    - port: http
+      interval: 30s
+    - port: metrics
+      interval: 30s`
+
+	newManifest := `apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+spec:
+  endpoints:
+    - port: admin
+      interval: 60s
+    - port: http
+      interval: 30s
+    - port: metrics
+      interval: 15s`
+
+	changeLines := func(result *diff.DiffResult) []string {
+		var lines []string
+		for _, change := range result.Changes() {
+			lines = append(lines, change.String())
+		}
+		return lines
+	}
+
+	// Without a merge key, elements are aligned by content and addressed by index
+	result, err := diff.New().CompareManifests(oldManifest, newManifest)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`spec.endpoints[0]: (added) {"interval":"60s","port":"admin"}`,
+		`spec.endpoints[2].interval: 30s -> 15s`,
+	}, changeLines(result))
+
+	d := diff.New(diff.WithMergeKeys(diff.MergeKeys{"spec.endpoints": {"port"}}))
+	result, err = d.CompareManifests(oldManifest, newManifest)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`spec.endpoints[port=metrics].interval: 30s -> 15s`,
+		`spec.endpoints[port=admin]: (added) {"interval":"60s","port":"admin"}`,
+	}, changeLines(result))
+}
+
+func TestDiffResult_Hunks(t *testing.T) {
+	d := diff.New(diff.WithContextLines(1))
+	result, err := d.CompareStrings("a\nb\nc\nd\ne\nf\ng\nh\n", "a\nB\nc\nd\ne\nf\ng\nh\ni\n")
+	require.NoError(t, err)
+
+	hunks := result.Hunks()
+	require.Len(t, hunks, 2)
+
+	assert.Equal(t, "@@ -1,3 +1,3 @@", hunks[0].Header())
+	assert.Equal(t, []diff.Line{
+		{Op: ' ', Text: "a", OldNumber: 1, NewNumber: 1},
+		{Op: '-', Text: "b", OldNumber: 2},
+		{Op: '+', Text: "B", NewNumber: 2},
+		{Op: ' ', Text: "c", OldNumber: 3, NewNumber: 3},
+	}, hunks[0].Lines)
+
+	assert.Equal(t, diff.Hunk{
+		OldStart: 8, OldLines: 1, NewStart: 8, NewLines: 2,
+		Lines: []diff.Line{
+			{Op: ' ', Text: "h", OldNumber: 8, NewNumber: 8},
+			{Op: '+', Text: "i", NewNumber: 9},
+		},
+	}, hunks[1])
+
+	assert.Equal(t, diff.Stats{LinesAdded: 2, LinesRemoved: 1}, result.Stats())
+}
+
+func TestDiffResult_Stats(t *testing.T) {
+	d := diff.New(diff.WithoutRenameDetection())
+
+	oldManifests := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.20
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: legacy`
+
+	newManifests := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.21
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web`
+
+	result, err := d.CompareMultipleManifests(oldManifests, newManifests)
+	require.NoError(t, err)
+
+	assert.Equal(t, diff.Stats{
+		LinesAdded:         2 + 4 + 4,
+		LinesRemoved:       2 + 4,
+		FieldsChanged:      2 + 1 + 1 + 1,
+		ResourcesAdded:     2,
+		ResourcesRemoved:   1,
+		ResourcesModified:  1,
+		ResourcesUnchanged: 1,
+	}, result.Stats())
+	assert.Empty(t, result.Hunks(), "hunks are reported per resource")
+
+	for _, res := range result.Resources() {
+		if res.Change == diff.Modified {
+			assert.Len(t, res.Result.Hunks(), 1)
+			assert.Len(t, res.Result.Changes(), 2)
+		}
+	}
+}
+
+func TestCompareStrings_IntraLineWords(t *testing.T) {
+	old := "name: web\nimage: registry.example.com/team/web:1.20.3\nreplicas: 2"
+	new := "name: web\nimage: registry.example.com/team/web:1.21.0\nreplicas: 2"
+
+	plain, err := diff.New().CompareStrings(old, new)
+	require.NoError(t, err)
+	result, err := diff.New(diff.WithIntraLineDiff(diff.WordGranularity)).CompareStrings(old, new)
+	require.NoError(t, err)
+
+	assert.Equal(t, plain.String(), result.String(), "the unified diff text is unchanged")
+	for _, line := range plain.Hunks()[0].Lines {
+		assert.Nil(t, line.Segments, "lines are not refined by default")
+	}
+
+	lines := result.Hunks()[0].Lines
+	require.Len(t, lines, 4)
+	assert.Equal(t, []diff.Segment{
+		{Op: ' ', Text: "image: registry.example.com/team/web:1."},
+		{Op: '-', Text: "20"},
+		{Op: ' ', Text: "."},
+		{Op: '-', Text: "3"},
+	}, lines[1].Segments)
+	assert.Equal(t, []diff.Segment{
+		{Op: ' ', Text: "image: registry.example.com/team/web:1."},
+		{Op: '+', Text: "21"},
+		{Op: ' ', Text: "."},
+		{Op: '+', Text: "0"},
+	}, lines[2].Segments)
+	assert.Nil(t, lines[0].Segments, "context lines are not refined")
+}
+
+func TestCompareStrings_IntraLineCharacters(t *testing.T) {
+	old := "digest: sha256:4f1c2e9a"
+	new := "digest: sha256:4f1d2e9a"
+
+	words, err := diff.New(diff.WithIntraLineDiff(diff.WordGranularity)).CompareStrings(old, new)
+	require.NoError(t, err)
+	assert.Equal(t, []diff.Segment{
+		{Op: ' ', Text: "digest: sha256:"},
+		{Op: '-', Text: "4f1c2e9a"},
+	}, words.Hunks()[0].Lines[0].Segments)
+
+	chars, err := diff.New(diff.WithIntraLineDiff(diff.CharGranularity)).CompareStrings(old, new)
+	require.NoError(t, err)
+	assert.Equal(t, []diff.Segment{
+		{Op: ' ', Text: "digest: sha256:4f1"},
+		{Op: '-', Text: "c"},
+		{Op: ' ', Text: "2e9a"},
+	}, chars.Hunks()[0].Lines[0].Segments)
+	assert.Equal(t, []diff.Segment{
+		{Op: ' ', Text: "digest: sha256:4f1"},
+		{Op: '+', Text: "d"},
+		{Op: ' ', Text: "2e9a"},
+	}, chars.Hunks()[0].Lines[1].Segments)
+}
+
+func TestCompareStrings_IntraLineUnrelatedLines(t *testing.T) {
+	result, err := diff.New(diff.WithIntraLineDiff(diff.WordGranularity)).CompareStrings("alpha beta", "gamma delta")
+	require.NoError(t, err)
+
+	for _, line := range result.Hunks()[0].Lines {
+		assert.Nil(t, line.Segments, "lines with nothing in common stay whole-line edits")
+	}
+}
+
+func TestCompareManifests_IntraLineStringValue(t *testing.T) {
+	old := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  config.json: '{"cache":{"enabled":true,"ttlSeconds":300},"endpoints":["https://a.example.com","https://b.example.com"],"retries":3}'`
+	new := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  config.json: '{"cache":{"enabled":true,"ttlSeconds":600},"endpoints":["https://a.example.com","https://b.example.com"],"retries":3}'`
+
+	// Compared as a plain string rather than as an embedded JSON document
+	result, err := diff.New(diff.WithIntraLineDiff(diff.WordGranularity), diff.WithoutEmbeddedDocuments()).CompareManifests(old, new)
+	require.NoError(t, err)
+
+	require.Len(t, result.Changes(), 1)
+	change := result.Changes()[0]
+	assert.Equal(t, `data["config.json"]`, change.Path)
+	assert.Equal(t, []diff.Segment{
+		{Op: ' ', Text: `{"cache":{"enabled":true,"ttlSeconds":`},
+		{Op: '-', Text: "300"},
+		{Op: '+', Text: "600"},
+		{Op: ' ', Text: `},"endpoints":["https://a.example.com","https://b.example.com"],"retries":3}`},
+	}, change.Segments)
+	assert.Equal(t, `data["config.json"]: {"cache":{"enabled":true,"ttlSeconds":[-300-]{+600+}},"endpoints":["http…`, change.String())
+
+	lines := result.Hunks()[0].Lines
+	assert.Equal(t, []diff.Segment{
+		{Op: ' ', Text: `  config.json: '{"cache":{"enabled":true,"ttlSeconds":`},
+		{Op: '-', Text: "300"},
+		{Op: ' ', Text: `},"endpoints":["https://a.example.com","https://b.example.com"],"retries":3}'`},
+	}, lines[len(lines)-2].Segments)
+
+	plain, err := diff.New(diff.WithoutEmbeddedDocuments()).CompareManifests(old, new)
+	require.NoError(t, err)
+	assert.Nil(t, plain.Changes()[0].Segments)
+}
+
+func TestCompareMultipleManifests_RenameDetection(t *testing.T) {
+	resource := func(name string, replicas int) string {
+		return fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %s
+  labels:
+    app.kubernetes.io/name: web
+    app.kubernetes.io/instance: prod
+spec:
+  replicas: %d
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: web
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.21
+          ports:
+            - containerPort: 8080`, name, replicas)
+	}
+	configMap := func(name, value string) string {
+		return fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n  key: %s", name, value)
+	}
+
+	oldManifests := resource("prod-web", 2) + "\n---\n" + configMap("prod-web-config", "a")
+	newManifests := resource("prod-web-chart", 3) + "\n---\n" + configMap("prod-settings", "b")
+
+	result, err := diff.New().CompareMultipleManifests(oldManifests, newManifests)
+	require.NoError(t, err)
+
+	resources := result.Resources()
+	require.Len(t, resources, 3)
+	deployment := resources[0]
+	assert.Equal(t, diff.Renamed, deployment.Change)
+	assert.Equal(t, "Deployment/prod-web-chart", deployment.ID.String())
+	require.NotNil(t, deployment.From)
+	assert.Equal(t, "Deployment/prod-web", deployment.From.String())
+	assert.InDelta(t, 17.0/19.0, deployment.Similarity, 0.001)
+	assert.Equal(t, "metadata.name: prod-web -> prod-web-chart\nspec.replicas: 2 -> 3", deployment.Result.StructuralString())
+	assert.Contains(t, result.String(), "--- Deployment/prod-web\n+++ Deployment/prod-web-chart\n")
+
+	// Two of six lines differ: a similarity of 2/3 is below the default
+	assert.Equal(t, diff.Removed, resources[1].Change)
+	assert.Equal(t, diff.Added, resources[2].Change)
+	assert.Equal(t, 1, result.Stats().ResourcesRenamed)
+	assert.Contains(t, result.StructuralString(), "Deployment/prod-web-chart (renamed from Deployment/prod-web):")
+
+	lenient, err := diff.New(diff.WithRenameThreshold(0.5)).CompareMultipleManifests(oldManifests, newManifests)
+	require.NoError(t, err)
+	assert.Equal(t, 2, lenient.Stats().ResourcesRenamed)
+
+	disabled, err := diff.New(diff.WithoutRenameDetection()).CompareMultipleManifests(oldManifests, newManifests)
+	require.NoError(t, err)
+	assert.Equal(t, 0, disabled.Stats().ResourcesRenamed)
+	assert.Equal(t, 2, disabled.Stats().ResourcesAdded)
+	assert.Equal(t, 2, disabled.Stats().ResourcesRemoved)
+}
+
+func TestCompareMultipleManifests_RenameRequiresSameKind(t *testing.T) {
+	oldManifests := "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: web\n  labels:\n    app: web\n    tier: frontend"
+	newManifests := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n  labels:\n    app: web\n    tier: frontend"
+
+	result, err := diff.New(diff.WithRenameThreshold(0.1)).CompareMultipleManifests(oldManifests, newManifests)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Stats().ResourcesAdded)
+	assert.Equal(t, 1, result.Stats().ResourcesRemoved)
+}
+
+func TestCompareMultipleManifests_RenameMostSimilarFirst(t *testing.T) {
+	doc := func(name, a, b string) string {
+		return fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n  a: %s\n  b: %s\n  c: shared\n  d: shared", name, a, b)
+	}
+	oldManifests := doc("one", "1", "1") + "\n---\n" + doc("two", "2", "2")
+	newManifests := doc("first", "2", "2") + "\n---\n" + doc("second", "1", "x")
+
+	result, err := diff.New(diff.WithRenameThreshold(0.5)).CompareMultipleManifests(oldManifests, newManifests)
+	require.NoError(t, err)
+
+	var renames []string
+	for _, res := range result.Resources() {
+		if res.Change == diff.Renamed {
+			renames = append(renames, res.From.Name+" -> "+res.ID.Name)
+		}
+	}
+	assert.Equal(t, []string{"one -> second", "two -> first"}, renames)
+}
+
+func TestWithRenameThreshold_Invalid(t *testing.T) {
+	for _, threshold := range []float64{0, -0.5, 1.5} {
+		_, err := diff.New(diff.WithRenameThreshold(threshold)).CompareMultipleManifests("", "")
+		assert.Error(t, err, "threshold %v", threshold)
+	}
+}
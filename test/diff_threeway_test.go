@@ -0,0 +1,173 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func threeWayDeployment(replicas int, image, logLevel string) string {
+	return fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: %d
+  template:
+    spec:
+      containers:
+        - name: web
+          image: %s
+          env:
+            - name: LOG_LEVEL
+              value: %s`, replicas, image, logLevel)
+}
+
+const threeWayService = `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  type: ClusterIP`
+
+func TestCompareThreeWay_ClassifiesChanges(t *testing.T) {
+	base := threeWayDeployment(2, "nginx:1.20", "info") + "\n---\n" + threeWayService
+	// Main branch bumped the image and the log level
+	current := threeWayDeployment(2, "nginx:1.21", "debug") + "\n---\n" + threeWayService
+	// The pull request scales up and sets the same log level
+	proposed := threeWayDeployment(3, "nginx:1.20", "debug") + "\n---\n" + threeWayService
+
+	result, err := diff.New().CompareThreeWay(base, current, proposed)
+	require.NoError(t, err)
+
+	require.Len(t, result.Resources(), 1, "the unchanged Service is not reported")
+	res := result.Resources()[0]
+	assert.Equal(t, "Deployment/web", res.ID.String())
+	assert.Equal(t, diff.Modified, res.Theirs)
+	assert.Equal(t, diff.Modified, res.Ours)
+	assert.False(t, result.HasConflicts())
+
+	origins := make(map[string]diff.Origin)
+	for _, c := range res.Changes {
+		origins[c.Path] = c.Origin
+	}
+	assert.Equal(t, map[string]diff.Origin{
+		"spec.replicas": diff.Ours,
+		"spec.template.spec.containers[name=web].image":                     diff.Theirs,
+		"spec.template.spec.containers[name=web].env[name=LOG_LEVEL].value": diff.Both,
+	}, origins)
+
+	assert.Equal(t, `Deployment/web (theirs modified, ours modified):
+  [ours] spec.replicas: 2 -> 3
+  [both] spec.template.spec.containers[name=web].env[name=LOG_LEVEL].value: info -> debug
+  [theirs] spec.template.spec.containers[name=web].image: nginx:1.20 -> nginx:1.21`, result.String())
+
+	assert.Equal(t, 1, result.Theirs().Stats().ResourcesModified)
+	assert.Equal(t, 1, result.Ours().Stats().ResourcesModified)
+}
+
+func TestCompareThreeWay_Conflicts(t *testing.T) {
+	base := threeWayDeployment(2, "nginx:1.20", "info")
+	current := threeWayDeployment(4, "nginx:1.20", "info")
+	proposed := threeWayDeployment(3, "nginx:1.20", "info")
+
+	result, err := diff.New().CompareThreeWay(base, current, proposed)
+	require.NoError(t, err)
+
+	assert.True(t, result.HasConflicts())
+	require.Len(t, result.Resources(), 1)
+	changes := result.Resources()[0].Changes
+	require.Len(t, changes, 1)
+	assert.Equal(t, diff.Conflict, changes[0].Origin)
+	assert.Equal(t, 4, changes[0].Theirs.NewValue)
+	assert.Equal(t, 3, changes[0].Ours.NewValue)
+	assert.Equal(t, "[conflict] spec.replicas: theirs 2 -> 4, ours 2 -> 3", changes[0].String())
+}
+
+func TestCompareThreeWay_NestedConflict(t *testing.T) {
+	base := threeWayDeployment(2, "nginx:1.20", "info")
+	// One side removes the container list entry the other side changes
+	current := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers: []`
+	proposed := threeWayDeployment(2, "nginx:1.22", "info")
+
+	result, err := diff.New().CompareThreeWay(base, current, proposed)
+	require.NoError(t, err)
+
+	changes := result.Resources()[0].Changes
+	require.Len(t, changes, 2)
+	assert.Equal(t, "spec.template.spec.containers[name=web]", changes[0].Path)
+	assert.Equal(t, diff.Conflict, changes[0].Origin)
+	assert.Nil(t, changes[0].Ours)
+	assert.Equal(t, "spec.template.spec.containers[name=web].image", changes[1].Path)
+	assert.Equal(t, diff.Conflict, changes[1].Origin)
+	assert.Equal(t, "[conflict] spec.template.spec.containers[name=web].image: nginx:1.20 -> nginx:1.22 (ours)", changes[1].String())
+}
+
+func TestCompareThreeWay_AddedAndRemovedResources(t *testing.T) {
+	configMap := func(name, value string) string {
+		return fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n  key: %s", name, value)
+	}
+	base := threeWayService + "\n---\n" + configMap("legacy", "a") + "\n---\n" + configMap("shared", "a")
+	current := configMap("shared", "b") + "\n---\n" + configMap("main-only", "a") + "\n---\n" + configMap("both", "same")
+	proposed := threeWayService + "\n---\n" + configMap("pr-only", "a") + "\n---\n" + configMap("both", "same")
+
+	result, err := diff.New(diff.WithoutRenameDetection()).CompareThreeWay(base, current, proposed)
+	require.NoError(t, err)
+
+	summary := make(map[string]string)
+	for _, res := range result.Resources() {
+		var origins []diff.Origin
+		for _, c := range res.Changes {
+			origins = append(origins, c.Origin)
+		}
+		summary[res.ID.String()] = fmt.Sprintf("%s/%s %v", res.Theirs, res.Ours, origins)
+	}
+	assert.Equal(t, map[string]string{
+		"Service/web":         "removed/unchanged [theirs]",
+		"ConfigMap/legacy":    "removed/removed [both]",
+		"ConfigMap/shared":    "modified/removed [conflict conflict]",
+		"ConfigMap/main-only": "added/unchanged [theirs]",
+		"ConfigMap/both":      "added/added [both]",
+		"ConfigMap/pr-only":   "unchanged/added [ours]",
+	}, summary)
+
+	var order []string
+	for _, res := range result.Resources() {
+		order = append(order, res.ID.Name)
+	}
+	assert.Equal(t, []string{"web", "legacy", "shared", "main-only", "both", "pr-only"}, order)
+}
+
+func TestCompareThreeWay_AddedDifferently(t *testing.T) {
+	added := func(value string) string {
+		return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: new\ndata:\n  key: " + value
+	}
+
+	result, err := diff.New().CompareThreeWay("", added("a"), added("b"))
+	require.NoError(t, err)
+
+	require.Len(t, result.Resources(), 1)
+	changes := result.Resources()[0].Changes
+	require.Len(t, changes, 1)
+	assert.Equal(t, "", changes[0].Path)
+	assert.Equal(t, diff.Conflict, changes[0].Origin)
+}
+
+func TestCompareThreeWay_InvalidManifests(t *testing.T) {
+	_, err := diff.New().CompareThreeWay(threeWayService, "kind: [unclosed", threeWayService)
+	assert.ErrorContains(t, err, "current")
+
+	_, err = diff.New().CompareThreeWay(threeWayService, threeWayService, "kind: [unclosed")
+	assert.ErrorContains(t, err, "proposed")
+}
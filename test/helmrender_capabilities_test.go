@@ -0,0 +1,186 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func capabilitiesOptions(t *testing.T) helmrender.RenderOptions {
+	return helmrender.RenderOptions{
+		ChartPath:   filepath.Join(getTestDataDir(t), "capabilities-chart"),
+		ReleaseName: "caps",
+	}
+}
+
+func writeCapabilitiesFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capabilities")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestCapabilities_KubeVersion(t *testing.T) {
+	renderer := helmrender.NewRenderer()
+
+	opts := capabilitiesOptions(t)
+	opts.KubeVersion = "1.27"
+	result, err := renderer.Render(opts)
+	require.NoError(t, err)
+	require.Len(t, result.Manifests, 1)
+	assert.Contains(t, result.Manifests[0], `kubernetes-version: "v1.27.0"`)
+	assert.NotContains(t, result.Manifests[0], "initContainers")
+
+	// Native sidecars are only rendered for 1.29 and later
+	opts.KubeVersion = "v1.30.2"
+	result, err = renderer.Render(opts)
+	require.NoError(t, err)
+	require.Len(t, result.Manifests, 1)
+	assert.Contains(t, result.Manifests[0], `kubernetes-version: "v1.30.2"`)
+	assert.Contains(t, result.Manifests[0], "initContainers")
+}
+
+func TestCapabilities_KubeVersionConstraint(t *testing.T) {
+	renderer := helmrender.NewRenderer()
+
+	// Helm's default version does not satisfy the kubeVersion of Chart.yaml
+	_, err := renderer.Render(capabilitiesOptions(t))
+	var renderErr *helmrender.RenderError
+	require.True(t, errors.As(err, &renderErr), "%v", err)
+	assert.Contains(t, err.Error(), "incompatible with Kubernetes v1.20.0")
+
+	opts := capabilitiesOptions(t)
+	opts.KubeVersion = "1.24"
+	_, err = renderer.Render(opts)
+	assert.ErrorContains(t, err, "incompatible with Kubernetes v1.24.0")
+
+	opts.KubeVersion = "one.thirty"
+	_, err = renderer.Render(opts)
+	var versionErr *helmrender.InvalidKubeVersionError
+	require.True(t, errors.As(err, &versionErr), "%v", err)
+	assert.Equal(t, "one.thirty", versionErr.Version)
+	assert.ErrorContains(t, err, `invalid kube version "one.thirty"`)
+}
+
+func TestCapabilities_APIVersions(t *testing.T) {
+	opts := capabilitiesOptions(t)
+	opts.KubeVersion = "1.30"
+	opts.APIVersions = []string{"monitoring.coreos.com/v1"}
+
+	result, err := helmrender.NewRenderer().Render(opts)
+	require.NoError(t, err)
+	assert.NotEmpty(t, findManifestByKind(result.Manifests, "ServiceMonitor"))
+	assert.Contains(t, getDeploymentManifest(result.Manifests), "pdb-api-version: policy/v1beta1\n", "API versions add to Helm's defaults")
+}
+
+func TestCapabilities_File(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// override is the KubeVersion option, for files without a version
+		override       string
+		kubeVersion    string
+		serviceMonitor bool
+		// helmAPIs is set when Helm's default API versions are kept, as the
+		// file lists no API versions
+		helmAPIs bool
+	}{
+		{
+			name: "document",
+			content: `kubeVersion: v1.30.2
+apiVersions:
+  - apps/v1
+  - monitoring.coreos.com/v1
+  - monitoring.coreos.com/v1/ServiceMonitor
+`,
+			kubeVersion:    "v1.30.2",
+			serviceMonitor: true,
+		},
+		{
+			name:           "api versions",
+			content:        "# kubectl api-versions\napps/v1\nmonitoring.coreos.com/v1\nv1\n",
+			override:       "1.27",
+			kubeVersion:    "v1.27.0",
+			serviceMonitor: true,
+		},
+		{
+			name: "discovery",
+			content: `{"kind":"APIGroupList","apiVersion":"v1","groups":[
+  {"name":"apps","versions":[{"groupVersion":"apps/v1","version":"v1"}]},
+  {"name":"monitoring.coreos.com","versions":[{"groupVersion":"monitoring.coreos.com/v1","version":"v1"}]}
+]}`,
+			override:       "1.27",
+			kubeVersion:    "v1.27.0",
+			serviceMonitor: true,
+		},
+		{
+			name: "kubectl version",
+			content: `clientVersion:
+  gitVersion: v1.31.0
+serverVersion:
+  gitVersion: v1.29.4
+`,
+			kubeVersion: "v1.29.4",
+			helmAPIs:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := capabilitiesOptions(t)
+			opts.CapabilitiesFile = writeCapabilitiesFile(t, tt.content)
+			opts.KubeVersion = tt.override
+
+			result, err := helmrender.NewRenderer().Render(opts)
+			require.NoError(t, err)
+			assert.Contains(t, getDeploymentManifest(result.Manifests), `kubernetes-version: "`+tt.kubeVersion+`"`)
+			assert.Equal(t, tt.serviceMonitor, findManifestByKind(result.Manifests, "ServiceMonitor") != "")
+
+			// policy/v1beta1 is among Helm's defaults but was removed in 1.25
+			pdbAPIVersion := "pdb-api-version: policy/v1\n"
+			if tt.helmAPIs {
+				pdbAPIVersion = "pdb-api-version: policy/v1beta1\n"
+			}
+			assert.Contains(t, getDeploymentManifest(result.Manifests), pdbAPIVersion)
+		})
+	}
+}
+
+func TestCapabilities_FileOverrides(t *testing.T) {
+	opts := capabilitiesOptions(t)
+	opts.CapabilitiesFile = writeCapabilitiesFile(t, "kubeVersion: v1.30.2\napiVersions: [apps/v1]\n")
+	opts.KubeVersion = "1.28"
+	opts.APIVersions = []string{"monitoring.coreos.com/v1"}
+
+	result, err := helmrender.NewRenderer().Render(opts)
+	require.NoError(t, err)
+	assert.Contains(t, getDeploymentManifest(result.Manifests), `kubernetes-version: "v1.28.0"`)
+	assert.NotEmpty(t, findManifestByKind(result.Manifests, "ServiceMonitor"))
+}
+
+func TestCapabilities_InvalidFile(t *testing.T) {
+	renderer := helmrender.NewRenderer()
+
+	opts := capabilitiesOptions(t)
+	opts.CapabilitiesFile = filepath.Join(t.TempDir(), "missing.yaml")
+	_, err := renderer.Render(opts)
+	var capsErr *helmrender.InvalidCapabilitiesError
+	require.True(t, errors.As(err, &capsErr), "%v", err)
+	assert.Equal(t, opts.CapabilitiesFile, capsErr.File)
+
+	// A syntax error is not mistaken for a list of API versions
+	opts.CapabilitiesFile = writeCapabilitiesFile(t, "kubeVersion: v1.30.2\napiVersions: [apps/v1\n")
+	_, err = renderer.Render(opts)
+	require.True(t, errors.As(err, &capsErr), "%v", err)
+	assert.Equal(t, opts.CapabilitiesFile, capsErr.File)
+
+	opts.CapabilitiesFile = writeCapabilitiesFile(t, "kind: APIResourceList\nresources: []\n")
+	_, err = renderer.Render(opts)
+	require.True(t, errors.As(err, &capsErr), "%v", err)
+	assert.ErrorContains(t, err, `unsupported kind "APIResourceList"`)
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/diff"
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare_ValuesFiles(t *testing.T) {
+	renderer := helmrender.NewRenderer()
+	chartPath := filepath.Join(getTestDataDir(t), "valid-chart")
+
+	opts := func(valuesFile string) helmrender.RenderOptions {
+		return helmrender.RenderOptions{
+			ChartPath:   chartPath,
+			ValuesFiles: []string{filepath.Join(chartPath, valuesFile)},
+			ReleaseName: "test-release",
+			Namespace:   "default",
+		}
+	}
+
+	result, err := renderer.Compare(opts("values-dev.yaml"), opts("values-prod.yaml"))
+	require.NoError(t, err)
+	assert.True(t, result.HasDifferences())
+	assert.NotEmpty(t, result.Old.Manifests)
+	assert.NotEmpty(t, result.New.Manifests)
+
+	changes := make(map[string]diff.ChangeType)
+	for _, res := range result.Manifests.Resources() {
+		changes[res.ID.Kind] = res.Change
+	}
+	assert.Equal(t, diff.Modified, changes["Deployment"])
+	assert.Equal(t, diff.Modified, changes["Service"])
+	assert.Equal(t, diff.Modified, changes["ConfigMap"])
+
+	require.True(t, result.Notes.HasDifferences())
+	assert.Contains(t, result.Notes.String(), "-Application test-release is exposed through a NodePort service.")
+	assert.Contains(t, result.Notes.String(), "+Application test-release is exposed through a LoadBalancer service.")
+}
+
+func TestCompare_SameOptions(t *testing.T) {
+	renderer := helmrender.NewRenderer()
+	opts := helmrender.RenderOptions{
+		ChartPath:   filepath.Join(getTestDataDir(t), "valid-chart"),
+		ReleaseName: "test-release",
+	}
+
+	result, err := renderer.Compare(opts, opts, diff.WithSemanticComparison())
+	require.NoError(t, err)
+	assert.False(t, result.HasDifferences())
+	assert.Empty(t, result.Manifests.String())
+}
+
+func TestCompare_RenderError(t *testing.T) {
+	renderer := helmrender.NewRenderer()
+	valid := helmrender.RenderOptions{
+		ChartPath:   filepath.Join(getTestDataDir(t), "valid-chart"),
+		ReleaseName: "test-release",
+	}
+	missing := valid
+	missing.ChartPath = filepath.Join(getTestDataDir(t), "does-not-exist")
+
+	_, err := renderer.Compare(valid, missing)
+	require.Error(t, err)
+	var notFound *helmrender.ChartNotFoundError
+	assert.True(t, errors.As(err, &notFound))
+	assert.Contains(t, err.Error(), "failed to render new chart")
+}
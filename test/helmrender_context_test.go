@@ -0,0 +1,205 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowChartOptions renders a chart looping loops squared times, taking
+// about a second for 1000 loops
+func slowChartOptions(t *testing.T, loops int) helmrender.RenderOptions {
+	return helmrender.RenderOptions{
+		ChartPath:   filepath.Join(getTestDataDir(t), "slow-chart"),
+		ReleaseName: "slow",
+		Values:      map[string]interface{}{"loops": loops},
+	}
+}
+
+func TestRenderContext_Completes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := helmrender.NewRenderer().RenderContext(ctx, slowChartOptions(t, 10))
+	require.NoError(t, err)
+	require.Len(t, result.Manifests, 1)
+	assert.Contains(t, result.Manifests[0], `iterations: "100"`)
+}
+
+func TestRenderContext_Deadline(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping slow render in short mode")
+	}
+	renderer := helmrender.NewRenderer(helmrender.WithMaxRenders(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := renderer.RenderContext(ctx, slowChartOptions(t, 1000))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	var timeoutErr *helmrender.RenderTimeoutError
+	require.True(t, errors.As(err, &timeoutErr), "%v", err)
+	assert.Equal(t, filepath.Join(getTestDataDir(t), "slow-chart"), timeoutErr.Chart)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The abandoned render holds the only slot until its template returns,
+	// so new renders fail fast instead of piling up
+	start = time.Now()
+	_, err = renderer.Render(slowChartOptions(t, 10))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	var busyErr *helmrender.RendererBusyError
+	require.True(t, errors.As(err, &busyErr), "%v", err)
+	assert.Equal(t, 1, busyErr.Limit)
+
+	// The slot is released once the abandoned template returns
+	require.Eventually(t, func() bool {
+		_, err := renderer.Render(slowChartOptions(t, 10))
+		return !errors.As(err, &busyErr)
+	}, 30*time.Second, 50*time.Millisecond)
+	result, err := renderer.Render(slowChartOptions(t, 10))
+	require.NoError(t, err)
+	assert.Len(t, result.Manifests, 1)
+}
+
+func TestRenderContext_UnlimitedByDefault(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping slow render in short mode")
+	}
+	renderer := helmrender.NewRenderer()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := renderer.RenderContext(ctx, slowChartOptions(t, 1000))
+		cancel()
+		var timeoutErr *helmrender.RenderTimeoutError
+		require.True(t, errors.As(err, &timeoutErr), "%v", err)
+	}
+
+	// Abandoned renders do not hold back others without WithMaxRenders
+	result, err := renderer.Render(slowChartOptions(t, 10))
+	require.NoError(t, err)
+	assert.Len(t, result.Manifests, 1)
+}
+
+func TestRenderContext_WaitsForSlot(t *testing.T) {
+	renderer := helmrender.NewRenderer(helmrender.WithMaxRenders(1))
+
+	// Renders that are not abandoned wait for each other
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = renderer.Render(slowChartOptions(t, 100))
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+// cancellingFS cancels a context when a file is opened and records the
+// files opened afterwards. It only implements Open, so that every read
+// goes through it.
+type cancellingFS struct {
+	fsys     fstest.MapFS
+	cancelAt string
+	cancel   context.CancelFunc
+	opened   []string
+	canceled bool
+}
+
+func (f *cancellingFS) Open(name string) (fs.File, error) {
+	if f.canceled {
+		f.opened = append(f.opened, name)
+	}
+	if name == f.cancelAt {
+		f.cancel()
+		f.canceled = true
+	}
+	return f.fsys.Open(name)
+}
+
+func TestRenderContext_CancelledWhileLoading(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fsys := &cancellingFS{
+		fsys: fstest.MapFS{
+			"parent/Chart.yaml": {Data: []byte(`apiVersion: v2
+name: parent
+version: 1.0.0
+dependencies:
+  - name: child
+    version: 1.0.0
+    repository: file://../child
+`)},
+			"parent/templates/cm.yaml": {Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: parent\n")},
+			"child/Chart.yaml":         {Data: []byte("apiVersion: v2\nname: child\nversion: 1.0.0\n")},
+			"child/templates/cm.yaml":  {Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: child\n")},
+			"child/values.yaml":        {Data: []byte("key: value\n")},
+		},
+		cancelAt: "child/Chart.yaml",
+		cancel:   cancel,
+	}
+
+	_, err := helmrender.NewRenderer().RenderContext(ctx, helmrender.RenderOptions{
+		ChartFS:     fsys,
+		ChartPath:   "parent",
+		ReleaseName: "loading",
+	})
+	var timeoutErr *helmrender.RenderTimeoutError
+	require.True(t, errors.As(err, &timeoutErr), "%v", err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "parent", timeoutErr.Chart)
+	assert.Empty(t, fsys.opened, "files read after the context was cancelled")
+}
+
+func TestRenderContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := helmrender.NewRenderer().RenderContext(ctx, slowChartOptions(t, 10))
+	var timeoutErr *helmrender.RenderTimeoutError
+	require.True(t, errors.As(err, &timeoutErr), "%v", err)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Invalid options are reported before the context
+	_, err = helmrender.NewRenderer().RenderContext(ctx, helmrender.RenderOptions{ChartPath: "missing", ReleaseName: "slow"})
+	var notFound *helmrender.ChartNotFoundError
+	assert.True(t, errors.As(err, &notFound), "%v", err)
+}
+
+func TestRenderContext_Concurrent(t *testing.T) {
+	renderer := helmrender.NewRenderer()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			opts := slowChartOptions(t, 10)
+			opts.KubeVersion = fmt.Sprintf("1.%d", 25+i)
+			_, errs[i] = renderer.RenderContext(ctx, opts)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func TestDependencies_VendoredSubchart(t *testing.T) {
+	chartPath := filepath.Join(getTestDataDir(t), "complex-chart")
+	renderer := helmrender.NewRenderer()
+
+	result, err := renderer.Render(helmrender.RenderOptions{
+		ChartPath:   chartPath,
+		ValuesFiles: []string{filepath.Join(chartPath, "values-huge.yaml")},
+		ReleaseName: "deps",
+	})
+	require.NoError(t, err)
+	statefulSet := findManifestByKind(result.Manifests, "StatefulSet")
+	require.NotEmpty(t, statefulSet)
+	assert.Contains(t, statefulSet, `value: "myapp"`)
+	assert.Contains(t, statefulSet, "storage: 100Gi")
+
+	// The condition disables the subchart
+	result, err = renderer.Render(helmrender.RenderOptions{
+		ChartPath:   chartPath,
+		ValuesFiles: []string{filepath.Join(chartPath, "values-minimal.yaml")},
+		ReleaseName: "deps",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, findManifestByKind(result.Manifests, "StatefulSet"))
+}
+
+// writeUmbrellaChart writes a chart depending on the child test chart
+// through a file:// path and on web through the local repository
+func writeUmbrellaChart(t *testing.T, childVersion string) string {
+	t.Helper()
+	dir := t.TempDir()
+	child := filepath.Join(getTestDataDir(t), "parent-chart", "charts", "child")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(`apiVersion: v2
+name: umbrella
+version: 0.1.0
+dependencies:
+  - name: child
+    version: "`+childVersion+`"
+    repository: file://`+child+`
+    alias: worker
+  - name: web
+    version: ^1.4
+    repository: "@local"
+    tags: [frontend]
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "values.yaml"), []byte(`tags:
+  frontend: false
+worker:
+  replicas: 3
+`), 0o644))
+	return dir
+}
+
+// localRepository packages the web chart into a local repository
+func localRepository(t *testing.T) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	packageVersions(t, dir, "1.4.2", "2.0.0")
+	index, err := repo.IndexDirectory(dir, "")
+	require.NoError(t, err)
+	require.NoError(t, index.WriteFile(filepath.Join(dir, "index.yaml"), 0o644))
+	return map[string]string{"local": dir}
+}
+
+func TestDependencies_FileAndRepository(t *testing.T) {
+	opts := helmrender.RenderOptions{
+		ChartPath:    writeUmbrellaChart(t, "^0.1.0"),
+		Repositories: localRepository(t),
+		ReleaseName:  "umbrella",
+	}
+	renderer := helmrender.NewRenderer()
+
+	result, err := renderer.Render(opts)
+	require.NoError(t, err)
+	require.Len(t, result.Manifests, 1)
+	// The alias scopes the values of the subchart
+	assert.Contains(t, result.Manifests[0], "replicas: 3")
+
+	// Tags enable the repository dependency
+	opts.Set = []string{"tags.frontend=true"}
+	result, err = renderer.Render(opts)
+	require.NoError(t, err)
+	assert.NotEmpty(t, findManifestByKind(result.Manifests, "Service"))
+
+	chart, err := helmrender.LoadChart(opts)
+	require.NoError(t, err)
+	versions := make(map[string]string)
+	for _, dep := range chart.Dependencies() {
+		versions[dep.Name()] = dep.Metadata.Version
+	}
+	assert.Equal(t, map[string]string{"child": "0.1.0", "web": "1.4.2"}, versions)
+}
+
+func TestDependencies_Unresolved(t *testing.T) {
+	_, err := helmrender.NewRenderer().Render(helmrender.RenderOptions{
+		ChartPath:   writeUmbrellaChart(t, "^0.2.0"),
+		ReleaseName: "umbrella",
+	})
+	var depErr *helmrender.DependencyError
+	require.True(t, errors.As(err, &depErr), "%v", err)
+	assert.Equal(t, "umbrella", depErr.Chart)
+
+	require.Len(t, depErr.Missing, 1)
+	assert.Equal(t, "web", depErr.Missing[0].Name)
+	assert.Equal(t, "@local", depErr.Missing[0].Repository)
+
+	require.Len(t, depErr.Mismatched, 1)
+	assert.Equal(t, helmrender.MismatchedDependency{Name: "child", Version: "^0.2.0", Found: "0.1.0"}, depErr.Mismatched[0])
+	assert.Contains(t, err.Error(), "child ^0.2.0 found version 0.1.0")
+}
+
+func TestDependencies_Vendor(t *testing.T) {
+	chartPath := writeUmbrellaChart(t, "^0.1.0")
+	require.NoError(t, helmrender.VendorDependencies(chartPath, localRepository(t)))
+
+	for _, archive := range []string{"child-0.1.0.tgz", "web-1.4.2.tgz"} {
+		assert.FileExists(t, filepath.Join(chartPath, "charts", archive))
+	}
+
+	// Vendored dependencies need neither the file:// path nor the repository
+	chart, err := helmrender.LoadChart(helmrender.RenderOptions{ChartPath: chartPath})
+	require.NoError(t, err)
+	assert.Len(t, chart.Dependencies(), 2)
+}
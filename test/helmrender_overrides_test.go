@@ -0,0 +1,82 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func renderDeployment(t *testing.T, opts helmrender.RenderOptions) string {
+	t.Helper()
+	opts.ChartPath = filepath.Join(getTestDataDir(t), "valid-chart")
+	opts.ReleaseName = "test-release"
+	result, err := helmrender.NewRenderer().Render(opts)
+	require.NoError(t, err)
+	deployment := findManifestByKind(result.Manifests, "Deployment")
+	require.NotEmpty(t, deployment)
+	return deployment
+}
+
+func TestRender_SetOverrides(t *testing.T) {
+	chartPath := filepath.Join(getTestDataDir(t), "valid-chart")
+	messageFile := filepath.Join(t.TempDir(), "message.txt")
+	require.NoError(t, os.WriteFile(messageFile, []byte("Hello from a file"), 0o644))
+
+	inline := map[string]interface{}{
+		"image": map[string]interface{}{"tag": "inline"},
+	}
+	deployment := renderDeployment(t, helmrender.RenderOptions{
+		ValuesFiles: []string{filepath.Join(chartPath, "values-dev.yaml")},
+		Values:      inline,
+		Set:         []string{"image.tag=1.2.3", "replicaCount=4"},
+		SetJSON:     []string{`resources={"limits":{"cpu":"2"}}`},
+		SetFile:     []string{"config.message=" + messageFile},
+		SetLiteral:  []string{"config.environment=dev,staging"},
+	})
+
+	assert.Contains(t, deployment, `image: "nginx:1.2.3"`)
+	assert.Contains(t, deployment, "replicas: 4")
+	assert.Contains(t, deployment, `cpu: "2"`)
+	assert.Contains(t, deployment, "Hello from a file")
+	assert.Contains(t, deployment, `value: "dev,staging"`)
+
+	// The caller's values are not modified by the overrides
+	assert.Equal(t, "inline", inline["image"].(map[string]interface{})["tag"])
+}
+
+func TestRender_SetPrecedence(t *testing.T) {
+	// --set-string is applied after --set, and --set after --set-json
+	deployment := renderDeployment(t, helmrender.RenderOptions{
+		SetJSON:   []string{`replicaCount=2`, `image.tag="json"`},
+		Set:       []string{"replicaCount=3", "image.tag=set"},
+		SetString: []string{"image.tag=007"},
+	})
+	assert.Contains(t, deployment, "replicas: 3")
+	assert.Contains(t, deployment, `image: "nginx:007"`)
+}
+
+func TestRender_InvalidOverride(t *testing.T) {
+	opts := helmrender.RenderOptions{
+		ChartPath:   filepath.Join(getTestDataDir(t), "valid-chart"),
+		ReleaseName: "test-release",
+		SetFile:     []string{"config.message=" + filepath.Join(t.TempDir(), "missing.txt")},
+	}
+
+	_, err := helmrender.NewRenderer().Render(opts)
+	require.Error(t, err)
+	var overrideErr *helmrender.InvalidOverrideError
+	require.True(t, errors.As(err, &overrideErr))
+	assert.Equal(t, "set-file", overrideErr.Flag)
+
+	opts.SetFile = nil
+	opts.Set = []string{"image.tag"}
+	_, err = helmrender.NewRenderer().Render(opts)
+	require.True(t, errors.As(err, &overrideErr))
+	assert.Equal(t, "set", overrideErr.Flag)
+	assert.Contains(t, err.Error(), `invalid --set override "image.tag"`)
+}
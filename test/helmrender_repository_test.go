@@ -0,0 +1,155 @@
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// packageVersions packages the valid test chart under the given versions
+// into dir and returns the archive contents by version
+func packageVersions(t *testing.T, dir string, versions ...string) map[string][]byte {
+	t.Helper()
+	archives := make(map[string][]byte)
+	for _, version := range versions {
+		chart, err := helmrender.LoadChart(helmrender.RenderOptions{ChartPath: filepath.Join(getTestDataDir(t), "valid-chart")})
+		require.NoError(t, err)
+		chart.Metadata.Name = "web"
+		chart.Metadata.Version = version
+		archive, err := chartutil.Save(chart, dir)
+		require.NoError(t, err)
+		archives[version], err = os.ReadFile(archive)
+		require.NoError(t, err)
+	}
+	return archives
+}
+
+func resolvedVersion(t *testing.T, opts helmrender.RenderOptions) string {
+	t.Helper()
+	chart, err := helmrender.LoadChart(opts)
+	require.NoError(t, err)
+	return chart.Metadata.Version
+}
+
+func TestChartRef_RepositoryIndex(t *testing.T) {
+	dir := t.TempDir()
+	packageVersions(t, dir, "1.3.0", "1.4.0", "1.4.2", "1.5.0-rc.1", "2.0.0")
+	index, err := repo.IndexDirectory(dir, "https://charts.example.com/")
+	require.NoError(t, err)
+	require.NoError(t, index.WriteFile(filepath.Join(dir, "index.yaml"), 0o644))
+
+	opts := helmrender.RenderOptions{
+		ChartRef:     "myrepo/web",
+		Repositories: map[string]string{"myrepo": dir},
+	}
+	for constraint, expected := range map[string]string{
+		"":         "2.0.0",
+		"^1.4":     "1.4.2",
+		"1.4.0":    "1.4.0",
+		"~1.5.0-0": "1.5.0-rc.1",
+	} {
+		opts.ChartVersion = constraint
+		assert.Equal(t, expected, resolvedVersion(t, opts), constraint)
+	}
+
+	opts.ChartVersion = "^1.4"
+	opts.ReleaseName = "repo"
+	result, err := helmrender.NewRenderer().Render(opts)
+	require.NoError(t, err)
+	assert.NotEmpty(t, findManifestByKind(result.Manifests, "Deployment"))
+}
+
+func TestChartRef_OCILayout(t *testing.T) {
+	dir := t.TempDir()
+	layout := filepath.Join(dir, "web")
+	archives := packageVersions(t, t.TempDir(), "1.4.0", "1.4.1+build.7", "1.6.0")
+	writeOCILayout(t, layout, archives)
+
+	opts := helmrender.RenderOptions{
+		ChartRef:     "oci/web",
+		Repositories: map[string]string{"oci": dir},
+	}
+	assert.Equal(t, "1.6.0", resolvedVersion(t, opts))
+	opts.ChartVersion = "~1.4"
+	assert.Equal(t, "1.4.1+build.7", resolvedVersion(t, opts))
+}
+
+// writeOCILayout stores chart archives as an OCI image layout tagged with
+// their versions, as helm push does
+func writeOCILayout(t *testing.T, dir string, archives map[string][]byte) {
+	t.Helper()
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	require.NoError(t, os.MkdirAll(blobs, 0o755))
+	writeBlob := func(data []byte) map[string]interface{} {
+		sum := sha256.Sum256(data)
+		encoded := hex.EncodeToString(sum[:])
+		require.NoError(t, os.WriteFile(filepath.Join(blobs, encoded), data, 0o644))
+		return map[string]interface{}{"digest": "sha256:" + encoded, "size": len(data)}
+	}
+	marshal := func(v interface{}) []byte {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return data
+	}
+
+	var manifests []interface{}
+	for version, archive := range archives {
+		config := writeBlob([]byte(`{"name":"web","version":"` + version + `"}`))
+		config["mediaType"] = "application/vnd.cncf.helm.config.v1+json"
+		layer := writeBlob(archive)
+		layer["mediaType"] = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+
+		manifest := writeBlob(marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+			"config":        config,
+			"layers":        []interface{}{layer},
+		}))
+		manifest["mediaType"] = "application/vnd.oci.image.manifest.v1+json"
+		manifest["annotations"] = map[string]string{
+			"org.opencontainers.image.ref.name": strings.ReplaceAll(version, "+", "_"),
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.json"), marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests":     manifests,
+	}), 0o644))
+}
+
+func TestChartRef_Errors(t *testing.T) {
+	dir := t.TempDir()
+	packageVersions(t, dir, "1.0.0")
+	index, err := repo.IndexDirectory(dir, "")
+	require.NoError(t, err)
+	require.NoError(t, index.WriteFile(filepath.Join(dir, "index.yaml"), 0o644))
+	repositories := map[string]string{"myrepo": dir}
+
+	for name, opts := range map[string]helmrender.RenderOptions{
+		"unknown repository": {ChartRef: "other/web"},
+		"malformed":          {ChartRef: "web"},
+		"unknown chart":      {ChartRef: "myrepo/api"},
+		"no matching":        {ChartRef: "myrepo/web", ChartVersion: "^2"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts.Repositories = repositories
+			_, err := helmrender.LoadChart(opts)
+			var resolveErr *helmrender.ChartResolveError
+			require.True(t, errors.As(err, &resolveErr), "%v", err)
+			assert.Equal(t, opts.ChartRef, resolveErr.Ref)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"embed"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+//go:embed all:testdata/parent-chart
+var embeddedCharts embed.FS
+
+func TestRender_EmbeddedChart(t *testing.T) {
+	result, err := helmrender.NewRenderer().Render(helmrender.RenderOptions{
+		ChartFS:     embeddedCharts,
+		ChartPath:   "testdata/parent-chart",
+		ReleaseName: "embedded",
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Manifests, 2)
+	assert.Contains(t, findManifestByKind(result.Manifests, "Deployment"), "name: embedded-child")
+}
+
+func TestRender_MapFSChart(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Chart.yaml":             {Data: []byte("apiVersion: v2\nname: inline\nversion: 0.1.0\n")},
+		"values.yaml":            {Data: []byte("greeting: hello\n")},
+		"templates/cm.yaml":      {Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\ndata:\n  greeting: {{ .Values.greeting }}\n")},
+		"templates/_helpers.tpl": {Data: []byte(`{{- define "inline.name" -}}inline{{- end -}}`)},
+	}
+
+	result, err := helmrender.NewRenderer().Render(helmrender.RenderOptions{
+		ChartFS:     fsys,
+		ReleaseName: "mapfs",
+		Set:         []string{"greeting=hi"},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Manifests, 1)
+	assert.Contains(t, result.Manifests[0], "greeting: hi")
+}
+
+func TestRender_PackagedChart(t *testing.T) {
+	chart, err := helmrender.LoadChart(helmrender.RenderOptions{ChartPath: filepath.Join(getTestDataDir(t), "valid-chart")})
+	require.NoError(t, err)
+	dir := t.TempDir()
+	archive, err := chartutil.Save(chart, dir)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(archive, ".tgz"))
+
+	renderer := helmrender.NewRenderer()
+	render := func(opts helmrender.RenderOptions) []string {
+		t.Helper()
+		opts.ReleaseName = "packaged"
+		result, err := renderer.Render(opts)
+		require.NoError(t, err)
+		return result.Manifests
+	}
+
+	fromPath := render(helmrender.RenderOptions{ChartPath: archive})
+	assert.NotEmpty(t, findManifestByKind(fromPath, "Deployment"))
+
+	f, err := os.Open(archive)
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, fromPath, render(helmrender.RenderOptions{ChartArchive: f}))
+
+	assert.Equal(t, fromPath, render(helmrender.RenderOptions{ChartFS: os.DirFS(dir), ChartPath: filepath.Base(archive)}))
+}
+
+func TestRender_LoadedChartIsReusable(t *testing.T) {
+	chart, err := helmrender.LoadChart(helmrender.RenderOptions{ChartPath: filepath.Join(getTestDataDir(t), "parent-chart")})
+	require.NoError(t, err)
+
+	renderer := helmrender.NewRenderer()
+	disabled, err := renderer.Render(helmrender.RenderOptions{Chart: chart, ReleaseName: "loaded", Set: []string{"child.enabled=false"}})
+	require.NoError(t, err)
+	assert.Len(t, disabled.Manifests, 1)
+
+	// Disabling the subchart did not remove it from the loaded chart
+	enabled, err := renderer.Render(helmrender.RenderOptions{Chart: chart, ReleaseName: "loaded"})
+	require.NoError(t, err)
+	assert.Len(t, enabled.Manifests, 2)
+	assert.Len(t, chart.Dependencies(), 1)
+}
+
+func TestRender_ChartSourceErrors(t *testing.T) {
+	renderer := helmrender.NewRenderer()
+
+	_, err := renderer.Render(helmrender.RenderOptions{
+		ChartPath:    "chart",
+		ChartArchive: strings.NewReader(""),
+		ReleaseName:  "errors",
+	})
+	assert.ErrorContains(t, err, "only one of")
+
+	_, err = renderer.Render(helmrender.RenderOptions{ChartFS: embeddedCharts, ChartPath: "testdata/missing", ReleaseName: "errors"})
+	var notFound *helmrender.ChartNotFoundError
+	assert.True(t, errors.As(err, &notFound))
+
+	_, err = renderer.Render(helmrender.RenderOptions{ChartArchive: strings.NewReader("not a chart"), ReleaseName: "errors"})
+	var loadErr *helmrender.ChartLoadError
+	require.True(t, errors.As(err, &loadErr))
+	assert.Equal(t, "archive", loadErr.Source)
+}
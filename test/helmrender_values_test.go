@@ -0,0 +1,226 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mishkaexe/lemuria/pkg/helmrender"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+// helmValues computes the values of a chart with Helm's own value merging
+// and coalescing, as helm template does
+func helmValues(t *testing.T, chartPath string, valuesFiles ...string) map[string]interface{} {
+	t.Helper()
+	return helmValuesWith(t, chartPath, &values.Options{ValueFiles: valuesFiles})
+}
+
+// helmValuesWith computes the values of a chart for the given value flags
+func helmValuesWith(t *testing.T, chartPath string, valueOpts *values.Options) map[string]interface{} {
+	t.Helper()
+	settings := cli.New()
+	merged, err := valueOpts.MergeValues(getter.All(settings))
+	require.NoError(t, err)
+
+	chart, err := loader.Load(chartPath)
+	require.NoError(t, err)
+	require.NoError(t, chartutil.ProcessDependenciesWithMerge(chart, merged))
+	coalesced, err := chartutil.CoalesceValues(chart, merged)
+	require.NoError(t, err)
+	return coalesced
+}
+
+// helmTemplate renders a chart with Helm's install action and values
+// merging, as helm template does
+func helmTemplate(t *testing.T, chartPath string, valuesFiles ...string) string {
+	t.Helper()
+	settings := cli.New()
+	merged, err := (&values.Options{ValueFiles: valuesFiles}).MergeValues(getter.All(settings))
+	require.NoError(t, err)
+
+	chart, err := loader.Load(chartPath)
+	require.NoError(t, err)
+
+	actionConfig := new(action.Configuration)
+	_ = actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), "memory", func(string, ...interface{}) {})
+	client := action.NewInstall(actionConfig)
+	client.DryRun = true
+	client.ClientOnly = true
+	client.Replace = true
+	client.ReleaseName = "compat"
+	client.Namespace = "default"
+	release, err := client.Run(chart, merged)
+	require.NoError(t, err)
+	return release.Manifest
+}
+
+func TestValues_HelmCompatibility(t *testing.T) {
+	testDataDir := getTestDataDir(t)
+	cases := []struct {
+		chart  string
+		values []string
+	}{
+		{"valid-chart", nil},
+		{"valid-chart", []string{"values-dev.yaml"}},
+		{"valid-chart", []string{"values-dev.yaml", "values-prod.yaml"}},
+		{"complex-chart", []string{"values-minimal.yaml"}},
+		{"complex-chart", []string{"values-huge.yaml"}},
+		{"parent-chart", nil},
+		{"parent-chart", []string{"values-override.yaml"}},
+	}
+
+	renderer := helmrender.NewRenderer()
+	for _, tc := range cases {
+		name := tc.chart
+		if len(tc.values) > 0 {
+			name += "/" + strings.Join(tc.values, "+")
+		}
+		t.Run(name, func(t *testing.T) {
+			chartPath := filepath.Join(testDataDir, tc.chart)
+			var valuesFiles []string
+			for _, v := range tc.values {
+				valuesFiles = append(valuesFiles, filepath.Join(chartPath, v))
+			}
+			opts := helmrender.RenderOptions{
+				ChartPath:   chartPath,
+				ValuesFiles: valuesFiles,
+				ReleaseName: "compat",
+				Namespace:   "default",
+			}
+
+			vals, err := renderer.Values(opts)
+			require.NoError(t, err)
+			assert.Equal(t, helmValues(t, chartPath, valuesFiles...), vals)
+
+			result, err := renderer.Render(opts)
+			require.NoError(t, err)
+			assert.Equal(t, helmTemplate(t, chartPath, valuesFiles...), joinRendered(result.Manifests))
+		})
+	}
+}
+
+// joinRendered joins manifests the way Helm separates them in a release
+func joinRendered(manifests []string) string {
+	var sb strings.Builder
+	for _, m := range manifests {
+		sb.WriteString("---\n" + m + "\n")
+	}
+	return sb.String()
+}
+
+func TestValues_Coalescing(t *testing.T) {
+	chartPath := filepath.Join(getTestDataDir(t), "parent-chart")
+
+	vals, err := helmrender.NewRenderer().Values(helmrender.RenderOptions{
+		ChartPath:   chartPath,
+		ValuesFiles: []string{filepath.Join(chartPath, "values-override.yaml")},
+		Values: map[string]interface{}{
+			"child": map[string]interface{}{"image": "busybox:1.37"},
+		},
+	})
+	require.NoError(t, err)
+
+	// null removes the chart default
+	assert.NotContains(t, vals, "resources")
+	// numbers are typed as by Helm
+	assert.Equal(t, float64(8080), vals["port"])
+	// import-values copies the exported values of the subchart
+	assert.Equal(t, map[string]interface{}{"color": "blue"}, vals["imported"])
+
+	child, ok := vals["child"].(map[string]interface{})
+	require.True(t, ok)
+	// subchart defaults are filled in below the override
+	assert.Equal(t, float64(2), child["replicas"])
+	assert.Equal(t, "busybox:1.37", child["image"])
+	// globals are propagated to subcharts
+	assert.Equal(t, map[string]interface{}{"environment": "production"}, child["global"])
+}
+
+func TestValues_OverridesLikeHelm(t *testing.T) {
+	chartPath := filepath.Join(getTestDataDir(t), "parent-chart")
+	hostsFile := filepath.Join(t.TempDir(), "hosts.yaml")
+	require.NoError(t, os.WriteFile(hostsFile, []byte("hosts:\n  - name: a\n    port: 80\n  - name: b\n    port: 81\n"), 0o644))
+
+	valueOpts := &values.Options{
+		ValueFiles: []string{filepath.Join(chartPath, "values-override.yaml"), hostsFile},
+		// An index sets a field of an element of the list from the file
+		Values:        []string{"hosts[1].port=8443", "child.replicas=3"},
+		StringValues:  []string{"child.tier=007"},
+		JSONValues:    []string{`child.annotations={"owner":"web"}`},
+		LiteralValues: []string{"note=a,b"},
+	}
+	vals, err := helmrender.NewRenderer().Values(helmrender.RenderOptions{
+		ChartPath:   chartPath,
+		ValuesFiles: valueOpts.ValueFiles,
+		Set:         valueOpts.Values,
+		SetString:   valueOpts.StringValues,
+		SetJSON:     valueOpts.JSONValues,
+		SetLiteral:  valueOpts.LiteralValues,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, helmValuesWith(t, chartPath, valueOpts), vals)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "a", "port": float64(80)},
+		map[string]interface{}{"name": "b", "port": int64(8443)},
+	}, vals["hosts"])
+}
+
+func TestValues_InlineValuesAndSources(t *testing.T) {
+	chartPath := filepath.Join(getTestDataDir(t), "parent-chart")
+	renderer := helmrender.NewRenderer()
+
+	// Inline values keep their Go types
+	vals, err := renderer.Values(helmrender.RenderOptions{
+		ChartPath: chartPath,
+		Values: map[string]interface{}{
+			"big":    int64(1<<60 + 1),
+			"legacy": map[interface{}]interface{}{"key": "value"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1<<60+1), vals["big"])
+	assert.Equal(t, map[interface{}]interface{}{"key": "value"}, vals["legacy"])
+
+	// Every values source is read once, and a failure names its source
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprintln(w, "child:\n  replicas: 4")
+	}))
+	defer server.Close()
+	invalidFile := filepath.Join(t.TempDir(), "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalidFile, []byte("child: [\n"), 0o644))
+
+	_, err = renderer.Values(helmrender.RenderOptions{
+		ChartPath:   chartPath,
+		ValuesFiles: []string{server.URL + "/values.yaml", invalidFile},
+	})
+	var valuesErr *helmrender.InvalidValuesError
+	require.True(t, errors.As(err, &valuesErr), "%v", err)
+	assert.Equal(t, invalidFile, valuesErr.File)
+	assert.Equal(t, int32(1), requests.Load())
+
+	_, err = renderer.Values(helmrender.RenderOptions{
+		ChartPath:   chartPath,
+		ValuesFiles: []string{server.URL + "/values.yaml"},
+		Set:         []string{"child.replicas"},
+	})
+	var overrideErr *helmrender.InvalidOverrideError
+	require.True(t, errors.As(err, &overrideErr), "%v", err)
+	assert.Equal(t, "set", overrideErr.Flag)
+	assert.Equal(t, int32(2), requests.Load())
+}